@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// lookupIP resolves the names of targets checked against the CIDRs of an
+// allowlist.
+var lookupIP = net.LookupIP
+
+// targetAllowlist are the targets /scrape may connect to besides the
+// configured redis nodes, so the endpoint can't be abused to reach
+// arbitrary hosts (SSRF). A nil allowlist allows all targets.
+type targetAllowlist struct {
+	nets []*net.IPNet
+	// patterns are matched against the whole target if they contain ://,
+	// otherwise against its host and host:port
+	patterns []string
+}
+
+// parseTargetAllowlist parses allowlist entries, each a CIDR like
+// 10.0.0.0/8, a host pattern like *.cache.internal or cache-1:6379, or a
+// pattern of the whole target like redis://*.cache.internal:6379. The
+// patterns are globs, see path.Match. No entries return a nil allowlist.
+func parseTargetAllowlist(entries []string) (*targetAllowlist, error) {
+	var a targetAllowlist
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if strings.Contains(e, "/") && !strings.Contains(e, "://") {
+			_, ipNet, err := net.ParseCIDR(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", e)
+			}
+			a.nets = append(a.nets, ipNet)
+			continue
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", e)
+		}
+		a.patterns = append(a.patterns, e)
+	}
+	if len(a.nets) == 0 && len(a.patterns) == 0 {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// allows returns an error unless target is allowed. Targets whose host is a
+// name are allowed by the CIDRs if all of its addresses are within them,
+// the returned IP is the checked address the target must be dialed at so
+// the name isn't resolved again, nil if the name wasn't resolved.
+func (a *targetAllowlist) allows(target string) (net.IP, error) {
+	if a == nil {
+		return nil, nil
+	}
+	canonical, err := canonicalTarget(target)
+	if err != nil {
+		return nil, fmt.Errorf("target %q not allowed: %s", target, err)
+	}
+	host, hostPort := targetHost(target)
+	for _, p := range a.patterns {
+		subject := []string{host, hostPort}
+		if strings.Contains(p, "://") {
+			subject = []string{canonical}
+		}
+		for _, s := range subject {
+			if ok, _ := path.Match(p, s); ok {
+				return nil, nil
+			}
+		}
+	}
+	if len(a.nets) > 0 && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			if containsIP(a.nets, ip) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("target %q not allowed", target)
+		}
+		ips, err := lookupIP(host)
+		if err != nil {
+			return nil, &resolveError{target: target, host: host, err: err}
+		}
+		if len(ips) > 0 && a.containsAll(ips) {
+			return ips[0], nil
+		}
+	}
+	return nil, fmt.Errorf("target %q not allowed", target)
+}
+
+// resolveError is returned by allows for targets whose name couldn't be
+// resolved, so they can't be checked against the CIDRs.
+type resolveError struct {
+	target, host string
+	err          error
+}
+
+func (e *resolveError) Error() string {
+	return fmt.Sprintf("target %q not allowed, couldn't resolve %s: %s", e.target, e.host, e.err)
+}
+
+// canonicalTarget returns target as matched against the patterns of whole
+// targets: scheme://host:port of URLs, rebuilt from the parsed URL so
+// nothing but the host and port can match the host part of a pattern, and
+// the path of unix:// URLs. URLs with a fragment, an opaque part or a path
+// other than the db are rejected.
+func canonicalTarget(target string) (string, error) {
+	if !strings.Contains(target, "://") {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.Fragment != "" || strings.Contains(target, "#") {
+		return "", fmt.Errorf("fragments aren't allowed")
+	}
+	if u.Opaque != "" {
+		return "", fmt.Errorf("invalid URL")
+	}
+	if u.Scheme == "unix" {
+		return "unix://" + u.Path, nil
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return "", fmt.Errorf("unexpected path %q, only the db is allowed", u.Path)
+		}
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// containsAll returns true if all ips are in one of the networks of a.
+func (a *targetAllowlist) containsAll(ips []net.IP) bool {
+	for _, ip := range ips {
+		if !containsIP(a.nets, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsIP returns true if ip is in one of nets.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSourceAllowlist parses CIDRs and single IPs, no entries return nil.
+func parseSourceAllowlist(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", e)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", e)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// targetHost returns the host and host:port of target, a redis URL or
+// host:port.
+func targetHost(target string) (string, string) {
+	hostPort := target
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "", ""
+		}
+		hostPort = u.Host
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// no port
+		host = strings.Trim(hostPort, "[]")
+	}
+	return host, hostPort
+}
+
+// loadMetricAllowlist reads the metric names of --metrics.allowlist-file,
+// one full name (including the namespace) per line, e.g.
+// redis_memory_used_bytes. Empty lines and lines starting with # are
+// ignored.
+func loadMetricAllowlist(file string) (map[string]bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if strings.ContainsAny(name, " \t{") {
+			return nil, fmt.Errorf("%s:%d: invalid metric name %q", file, line, name)
+		}
+		names[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// allowlistGatherer only passes on the metric families of g listed in
+// names, so the series a scrape can return are known in advance. Histograms
+// and summaries are listed by their base name.
+type allowlistGatherer struct {
+	g     prometheus.Gatherer
+	names map[string]bool
+}
+
+func (a allowlistGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := a.g.Gather()
+	var res []*dto.MetricFamily
+	for _, mf := range mfs {
+		if a.names[mf.GetName()] {
+			res = append(res, mf)
+		}
+	}
+	return res, err
+}
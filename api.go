@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+)
+
+// number of largest keys returned by /api/scan if the request doesn't say
+const defaultScanAPITop = 10
+
+// scanRequest is the body of POST /api/scan.
+type scanRequest struct {
+	Target  string `json:"target"`
+	DB      string `json:"db"`
+	Pattern string `json:"pattern"`
+	Limit   int    `json:"limit"`
+	Top     int    `json:"top"`
+}
+
+// scanAPIHandler serves POST /api/scan, analyzing the keys matching pattern
+// on one of the configured redis nodes. At most --api.scan-limit keys are
+// looked at, whatever the request asks for.
+func scanAPIHandler(exp *exporter.Exporter, addrs []string, limit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req := scanRequest{DB: "0", Pattern: "*", Top: defaultScanAPITop}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		if !contains(addrs, req.Target) {
+			http.Error(w, fmt.Sprintf("unknown target %q", req.Target), http.StatusBadRequest)
+			return
+		}
+		if req.Limit <= 0 || req.Limit > limit {
+			req.Limit = limit
+		}
+
+		res, err := exp.AnalyzeKeys(req.Target, strings.TrimPrefix(req.DB, "db"), req.Pattern, req.Limit, req.Top)
+		if err != nil {
+			log.WithField("target", exporter.LabelAddr(req.Target)).WithError(err).Error("key scan failed")
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// sdTargetGroup is an entry of the Prometheus HTTP SD format.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler serves GET /sd, the configured and the registered redis nodes
+// in the Prometheus HTTP SD format. Each node is a target scraped through
+// /scrape of this exporter, at the address the request was sent to.
+func (i *instance) sdHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	groups := []sdTargetGroup{}
+	for _, st := range i.exp.TargetStatuses() {
+		alias := ""
+		for addr, a := range i.aliases {
+			if exporter.LabelAddr(addr) == exporter.LabelAddr(st.Addr) {
+				alias = a
+			}
+		}
+		groups = append(groups, sdGroup(r.Host, st.Addr, alias, st.Role, i.settings.shardFlag))
+	}
+	for _, t := range i.registered.list() {
+		groups = append(groups, sdGroup(r.Host, t.Addr, t.Alias, t.Role, i.settings.shardFlag))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// sdGroup returns the target group of the redis node addr scraped through
+// the exporter at host as part of shard, labels with empty values are left
+// out.
+func sdGroup(host, addr, alias, role, shard string) sdTargetGroup {
+	target := exporter.LabelAddr(addr)
+	labels := map[string]string{
+		"__metrics_path__": "/scrape",
+		"__param_target":   target,
+		"instance":         target,
+	}
+	for name, value := range map[string]string{"alias": alias, "role": role, "shard": shard} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	return sdTargetGroup{Targets: []string{host}, Labels: labels}
+}
+
+// targetsAPIHandler serves GET /api/targets, the configured redis nodes and
+// the outcome of their last scrape.
+func targetsAPIHandler(exp *exporter.Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exp.TargetStatuses())
+	}
+}
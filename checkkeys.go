@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+)
+
+// readCheckKeysFile reads a file with one check-keys entry per line, empty
+// lines and lines starting with # are ignored. The entries are returned
+// comma separated, like --check-keys.
+func readCheckKeysFile(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(keys, ","), nil
+}
+
+// allCheckKeys returns the keys of --check-keys and --check-keys-file.
+func (s *settings) allCheckKeys() (string, error) {
+	if s.checkKeysFile == "" {
+		return s.checkKeys, nil
+	}
+	keys, err := readCheckKeysFile(s.checkKeysFile)
+	if err != nil {
+		return "", err
+	}
+	if s.checkKeys != "" && keys != "" {
+		keys = s.checkKeys + "," + keys
+	} else if s.checkKeys != "" {
+		keys = s.checkKeys
+	}
+	return keys, exporter.ValidateCheckKeys(keys)
+}
+
+// reloadCheckKeysOnHUP reloads --check-keys-file into the exporter of the
+// instance returned by inst whenever the process receives SIGHUP, keeping
+// the current keys if the file is invalid.
+func reloadCheckKeysOnHUP(inst func() *instance) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		i := inst()
+		keys, err := i.settings.allCheckKeys()
+		if err == nil {
+			err = i.exp.SetCheckKeys(keys)
+		}
+		if err != nil {
+			log.Errorf("Couldn't reload %s, keeping the current keys, err: %s", i.settings.checkKeysFile, err)
+			continue
+		}
+		log.Infof("Reloaded check keys from %s", i.settings.checkKeysFile)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	scanPattern *string
+	scanDB      *string
+	scanLimit   *int
+
+	rdbFile   *string
+	rdbFormat *string
+	rdbTop    *int
+
+	scrapeStrict *bool
+)
+
+// exit codes of scrape-once --strict
+const (
+	exitConnectFailure = 3
+	exitAuthFailure    = 4
+	exitPartialFailure = 5
+)
+
+func runCheckConfig() int {
+	if flags.configFile == "" {
+		fmt.Fprintln(os.Stderr, "check-config: --config.file is required")
+		return 2
+	}
+	return checkConfig(flags.configFile)
+}
+
+func scrapeOnceFlags() {
+	scrapeStrict = flag.Bool("strict", false, "Exit with 3 if a redis node couldn't be reached, 4 if one rejected the credentials and 5 if only some metrics of one could be collected")
+}
+
+// scrapeOnce scrapes all redis nodes a single time and writes the metrics
+// in the Prometheus text format to stdout.
+func scrapeOnce() int {
+	inst, _, err := newExporter()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(inst.exp)
+	mfs, err := registry.Gather()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(os.Stdout, mf); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+	if *scrapeStrict {
+		return strictExitCode(inst.exp.TargetStatuses())
+	}
+	return 0
+}
+
+// strictExitCode returns the exit code of scrape-once --strict for statuses,
+// authentication failures taking precedence over connection failures and
+// those over partial ones.
+func strictExitCode(statuses []exporter.TargetStatus) int {
+	failures := map[string]bool{}
+	for _, st := range statuses {
+		if st.Failure != "" {
+			log.WithField("target", st.Addr).Errorf("%s failure: %s", st.Failure, st.Error)
+			failures[st.Failure] = true
+		}
+	}
+	switch {
+	case failures[exporter.FailureAuth]:
+		return exitAuthFailure
+	case failures[exporter.FailureConnect]:
+		return exitConnectFailure
+	case failures[exporter.FailurePartial]:
+		return exitPartialFailure
+	}
+	return 0
+}
+
+func scanKeysFlags() {
+	scanPattern = flag.String("scan.pattern", "*", "Pattern of the keys to look for")
+	scanDB = flag.String("scan.db", "0", "Database to scan")
+	scanLimit = flag.Int("scan.limit", 100, "Maximum number of keys to print, 0 means no limit")
+}
+
+// scanKeys prints the keys matching --scan.pattern of the first redis node
+// together with their type and length or size.
+func scanKeys() int {
+	inst, _, err := newExporter()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	keys, err := inst.exp.ScanKeys(inst.addrs[0], strings.TrimPrefix(*scanDB, "db"), *scanPattern, *scanLimit)
+	for _, k := range keys {
+		fmt.Printf("db%s\t%s\t%s\t%d\n", k.DB, k.Key, k.Type, k.Size)
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+func analyzeRDBFlags() {
+	rdbFile = flag.String("rdb.file", "", "RDB dump to analyze")
+	rdbFormat = flag.String("rdb.format", "text", "Output format, text (Prometheus text format) or json")
+	rdbTop = flag.Int("rdb.top", 10, "Number of biggest keys to print")
+}
+
+// analyzeRDB prints the keyspace statistics of the RDB dump --rdb.file
+// without connecting to redis.
+func analyzeRDB() int {
+	if *rdbFile == "" {
+		fmt.Fprintln(os.Stderr, "analyze-rdb: --rdb.file is required")
+		return 2
+	}
+	if *rdbFormat != "text" && *rdbFormat != "json" {
+		fmt.Fprintf(os.Stderr, "analyze-rdb: invalid --rdb.format %q\n", *rdbFormat)
+		return 2
+	}
+	f, err := os.Open(*rdbFile)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer f.Close()
+
+	a, err := exporter.AnalyzeRDB(f, *rdbTop)
+	if err != nil {
+		log.Errorf("%s: %s", *rdbFile, err)
+		return 1
+	}
+	if *rdbFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(a); err != nil {
+			log.Error(err)
+			return 1
+		}
+		return 0
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter.NewRDBCollector(a, flags.namespace))
+	mfs, err := registry.Gather()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(os.Stdout, mf); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oliver006/redis_exporter/exporter"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the file passed via --config.file
+type Config struct {
+	Namespace                string                       `yaml:"namespace"`
+	NamespaceMap             map[string]string            `yaml:"namespace_map"`
+	CheckKeys                []string                     `yaml:"check_keys"`
+	CheckKeysFile            string                       `yaml:"check_keys_file"`
+	CheckKeysGlob            bool                         `yaml:"check_keys_glob"`
+	CheckKeysGlobLimit       int                          `yaml:"check_keys_glob_limit"`
+	CheckKeysMemorySamples   *int                         `yaml:"check_keys_memory_samples"`
+	CheckKeysDebugObject     bool                         `yaml:"check_keys_debug_object"`
+	CheckBitmapKeys          []string                     `yaml:"check_bitmap_keys"`
+	CheckGeoKeys             []string                     `yaml:"check_geo_keys"`
+	CheckValueLabelKeys      []string                     `yaml:"check_value_label_keys"`
+	CheckHashFieldKeys       []string                     `yaml:"check_hash_field_keys"`
+	CheckHashFieldTTLKeys    []string                     `yaml:"check_hash_field_ttl_keys"`
+	CheckMemberPatternKeys   []string                     `yaml:"check_member_pattern_keys"`
+	CountKeyGroups           []string                     `yaml:"count_key_groups"`
+	KeyspaceSample           KeyspaceSampleConfig         `yaml:"keyspace_sample"`
+	ScanCount                int                          `yaml:"scan_count"`
+	ScanKeysPerSecond        float64                      `yaml:"scan_keys_per_second"`
+	ScanChunk                int                          `yaml:"scan_chunk"`
+	Pipeline                 bool                         `yaml:"pipeline"`
+	DialTimeout              time.Duration                `yaml:"dial_timeout"`
+	KeepAlive                time.Duration                `yaml:"keepalive"`
+	ResetAfterFailures       int                          `yaml:"reset_after_failures"`
+	Failover                 bool                         `yaml:"failover"`
+	DiscoverReplicas         bool                         `yaml:"discover_replicas"`
+	Sentinel                 SentinelConfig               `yaml:"sentinel"`
+	MaxConcurrentScrapes     int                          `yaml:"max_concurrent_scrapes"`
+	MaxSeriesPerTarget       int                          `yaml:"max_series_per_target"`
+	MaxSeriesPerScrape       int                          `yaml:"max_series_per_scrape"`
+	MaxResponseBytes         int                          `yaml:"max_response_bytes"`
+	MetricsAllowlistFile     string                       `yaml:"metrics_allowlist_file"`
+	Shard                    string                       `yaml:"shard"`
+	HALockFile               string                       `yaml:"ha_lock_file"`
+	HALeaseDuration          time.Duration                `yaml:"ha_lease_duration"`
+	CacheTTL                 time.Duration                `yaml:"cache_ttl"`
+	KeyCacheTTL              time.Duration                `yaml:"key_cache_ttl"`
+	MinScrapeInterval        time.Duration                `yaml:"min_scrape_interval"`
+	BackgroundScrapeInterval time.Duration                `yaml:"background_scrape_interval"`
+	BackgroundScrapeJitter   float64                      `yaml:"background_scrape_jitter"`
+	RateWindow               time.Duration                `yaml:"rate_window"`
+	Deltas                   bool                         `yaml:"deltas"`
+	CommandStatsTopN         int                          `yaml:"command_stats_top_n"`
+	CommandStatsCommands     []string                     `yaml:"command_stats_commands"`
+	DBAggregateThreshold     int                          `yaml:"db_aggregate_threshold"`
+	ClusterKeyspaceTotals    bool                         `yaml:"cluster_keyspace_totals"`
+	DiscoverInfoFields       bool                         `yaml:"discover_info_fields"`
+	ClusterSlotSamples       int                          `yaml:"cluster_slot_samples"`
+	WaitProbeReplicas        int                          `yaml:"wait_probe_replicas"`
+	WaitProbeTimeout         time.Duration                `yaml:"wait_probe_timeout"`
+	MonitorSampleDuration    time.Duration                `yaml:"monitor_sample_duration"`
+	MetricDescriptions       map[string]MetricDescription `yaml:"metric_descriptions"`
+	TLS                      TLSConfig                    `yaml:"tls"`
+	WebTLS                   WebTLSConfig                 `yaml:"web_tls"`
+	Tracing                  TracingConfig                `yaml:"tracing"`
+	Vault                    VaultConfig                  `yaml:"vault"`
+	Targets                  []TargetConfig               `yaml:"targets"`
+	Instances                []InstanceConfig             `yaml:"instances"`
+	Modules                  map[string]ModuleConfig      `yaml:"modules"`
+	ScrapeAllowedTargets     []string                     `yaml:"scrape_allowed_targets"`
+	WebAllowedSources        []string                     `yaml:"web_allowed_sources"`
+}
+
+// TargetConfig is a single redis node to scrape.
+type TargetConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	// Alias is a name of the target for the labels of /sd.
+	Alias string `yaml:"alias"`
+	// VaultPath is the path of the Vault secret holding the password, e.g.
+	// secret/data/redis/prod, see VaultConfig.
+	VaultPath string `yaml:"vault_path"`
+	// Mode is "full", the default, or "minimal" to only check the target
+	// is up via PING, e.g. for proxies rejecting INFO.
+	Mode string `yaml:"mode"`
+	// ConnectTimeout and Timeout override the connect timeout and the read
+	// and write timeout of the redis commands of the target, e.g. for cross
+	// region targets.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// InstanceConfig is an additional exporter served by the same process, with
+// its own targets and listen address. All settings it doesn't have are
+// taken over from the main exporter.
+type InstanceConfig struct {
+	Name          string         `yaml:"name"`
+	Namespace     string         `yaml:"namespace"`
+	ListenAddress string         `yaml:"listen_address"`
+	CheckKeys     []string       `yaml:"check_keys"`
+	Targets       []TargetConfig `yaml:"targets"`
+}
+
+// MetricDescription overrides the HELP text of a metric and adds a
+// documentation URL to it.
+type MetricDescription struct {
+	Help string `yaml:"help"`
+	URL  string `yaml:"url"`
+}
+
+// ModuleConfig is a named scrape profile of /scrape, selected via the
+// module parameter like the modules of the blackbox_exporter. Settings it
+// doesn't have are the ones of the exporter.
+type ModuleConfig struct {
+	Namespace string   `yaml:"namespace"`
+	Sections  []string `yaml:"sections"`
+	CheckKeys []string `yaml:"check_keys"`
+	// Timeout is the connect timeout as well as the read and write timeout
+	// of the redis commands.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// apply returns opts with the settings of m.
+func (m ModuleConfig) apply(opts exporter.Options) exporter.Options {
+	if m.Namespace != "" {
+		opts.Namespace = m.Namespace
+	}
+	if len(m.Sections) > 0 {
+		opts.Sections = m.Sections
+	}
+	if len(m.CheckKeys) > 0 {
+		opts.CheckKeys = strings.Join(m.CheckKeys, ",")
+	}
+	if m.Timeout > 0 {
+		d := net.Dialer{}
+		if opts.Dialer != nil {
+			d = *opts.Dialer
+		}
+		d.Timeout = m.Timeout
+		opts.Dialer, opts.CommandTimeout = &d, m.Timeout
+	}
+	return opts
+}
+
+// SentinelConfig configures registering the nodes monitored by the sentinels
+// among the targets, see --sentinel.register-targets.
+type SentinelConfig struct {
+	RegisterTargets  bool          `yaml:"register_targets"`
+	RegisterReplicas bool          `yaml:"register_replicas"`
+	RegisterInterval time.Duration `yaml:"register_interval"`
+}
+
+// TracingConfig configures tracing the scrapes, see --tracing.otlp-endpoint.
+type TracingConfig struct {
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	ServiceName  string  `yaml:"service_name"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+// KeyspaceSampleConfig configures sampling the keyspace, see
+// --keyspace-sample.
+type KeyspaceSampleConfig struct {
+	DBs      []string  `yaml:"dbs"`
+	Limit    int       `yaml:"limit"`
+	Buckets  []float64 `yaml:"buckets"`
+	TopN     int       `yaml:"top_n"`
+	IdleTime bool      `yaml:"idle_time"`
+}
+
+// TLSConfig holds the settings for connecting to rediss:// targets.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
+}
+
+// WebTLSConfig holds the settings for serving the exporter's HTTP endpoints
+// via HTTPS, optionally only to clients with a certificate signed by
+// ClientCAFile (mTLS).
+type WebTLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// build returns the server tls.Config described by c, or nil if nothing is
+// configured.
+func (c WebTLSConfig) build() (*tls.Config, error) {
+	if c == (WebTLSConfig{}) {
+		return nil, nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("cert_file and key_file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cert_file/key_file: %s", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if c.ClientCAFile != "" {
+		ca, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("client_ca_file: %s", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("client_ca_file: no certificates found in %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// loadConfig reads and parses the config file, unknown fields are an error.
+func loadConfig(fileName string) (*Config, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", fileName, err)
+	}
+	return cfg, nil
+}
+
+// validate returns all problems found in the config, each prefixed with
+// the location of the offending setting.
+func (c *Config) validate() []error {
+	var errs []error
+	if c.MaxConcurrentScrapes < 0 {
+		errs = append(errs, fmt.Errorf("max_concurrent_scrapes: must not be negative"))
+	}
+	if c.ResetAfterFailures < 0 {
+		errs = append(errs, fmt.Errorf("reset_after_failures: must not be negative"))
+	}
+	if c.MaxSeriesPerTarget < 0 {
+		errs = append(errs, fmt.Errorf("max_series_per_target: must not be negative"))
+	}
+	if _, err := parseShard(c.Shard); err != nil {
+		errs = append(errs, fmt.Errorf("shard: %s", err))
+	}
+	if c.HALeaseDuration < 0 {
+		errs = append(errs, fmt.Errorf("ha_lease_duration: must not be negative"))
+	}
+	for addr, ns := range c.NamespaceMap {
+		if err := exporter.ValidateNamespace(ns); err != nil {
+			errs = append(errs, fmt.Errorf("namespace_map.%s: %s", exporter.RedactAddr(addr), err))
+		}
+	}
+	if c.MaxSeriesPerScrape < 0 {
+		errs = append(errs, fmt.Errorf("max_series_per_scrape: must not be negative"))
+	}
+	if c.MaxResponseBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_response_bytes: must not be negative"))
+	}
+	if c.Sentinel.RegisterInterval < 0 {
+		errs = append(errs, fmt.Errorf("sentinel.register_interval: must not be negative"))
+	}
+	if c.ScanChunk < 0 {
+		errs = append(errs, fmt.Errorf("scan_chunk: must not be negative"))
+	}
+	if c.ScanKeysPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("scan_keys_per_second: must not be negative"))
+	}
+	if c.RateWindow < 0 {
+		errs = append(errs, fmt.Errorf("rate_window: must not be negative"))
+	}
+	if c.KeyCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("key_cache_ttl: must not be negative"))
+	}
+	if c.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("cache_ttl: must not be negative"))
+	}
+	if c.MinScrapeInterval < 0 {
+		errs = append(errs, fmt.Errorf("min_scrape_interval: must not be negative"))
+	}
+	if c.BackgroundScrapeInterval < 0 {
+		errs = append(errs, fmt.Errorf("background_scrape_interval: must not be negative"))
+	}
+	if c.BackgroundScrapeJitter < 0 || c.BackgroundScrapeJitter >= 1 {
+		errs = append(errs, fmt.Errorf("background_scrape_jitter: must be at least 0 and less than 1"))
+	}
+	if c.CommandStatsTopN < 0 {
+		errs = append(errs, fmt.Errorf("command_stats_top_n: must not be negative"))
+	}
+	if c.DBAggregateThreshold < 0 {
+		errs = append(errs, fmt.Errorf("db_aggregate_threshold: must not be negative"))
+	}
+	if c.ClusterSlotSamples < 0 {
+		errs = append(errs, fmt.Errorf("cluster_slot_samples: must not be negative"))
+	}
+	if c.WaitProbeReplicas < 0 {
+		errs = append(errs, fmt.Errorf("wait_probe_replicas: must not be negative"))
+	}
+	if c.WaitProbeTimeout < 0 {
+		errs = append(errs, fmt.Errorf("wait_probe_timeout: must not be negative"))
+	}
+	if c.MonitorSampleDuration < 0 {
+		errs = append(errs, fmt.Errorf("monitor_sample_duration: must not be negative"))
+	}
+	for idx, k := range c.CheckKeys {
+		if err := exporter.ValidateCheckKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_keys[%d]: %s", idx, err))
+		}
+	}
+	if c.CheckKeysGlobLimit < 0 {
+		errs = append(errs, fmt.Errorf("check_keys_glob_limit: must not be negative"))
+	}
+	if c.CheckKeysMemorySamples != nil && *c.CheckKeysMemorySamples < 0 {
+		errs = append(errs, fmt.Errorf("check_keys_memory_samples: must not be negative"))
+	}
+	if c.DialTimeout < 0 {
+		errs = append(errs, fmt.Errorf("dial_timeout: must not be negative"))
+	}
+	if c.ScanCount < 0 {
+		errs = append(errs, fmt.Errorf("scan_count: must not be negative"))
+	}
+	if c.CheckKeysFile != "" {
+		keys, err := readCheckKeysFile(c.CheckKeysFile)
+		if err == nil {
+			err = exporter.ValidateCheckKeys(keys)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("check_keys_file: %s", err))
+		}
+	}
+	for idx, k := range c.CheckBitmapKeys {
+		if err := exporter.ValidateCheckKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_bitmap_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, k := range c.CheckValueLabelKeys {
+		if err := exporter.ValidateCheckKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_value_label_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, k := range c.CheckHashFieldKeys {
+		if err := exporter.ValidateCheckKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_hash_field_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, k := range c.CheckHashFieldTTLKeys {
+		if err := exporter.ValidateHashFieldTTLKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_hash_field_ttl_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, k := range c.CheckMemberPatternKeys {
+		if err := exporter.ValidateMemberPatternKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_member_pattern_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, g := range c.CountKeyGroups {
+		if err := exporter.ValidateKeyGroups(g); err != nil {
+			errs = append(errs, fmt.Errorf("count_key_groups[%d]: %s", idx, err))
+		}
+	}
+	for idx, db := range c.KeyspaceSample.DBs {
+		if err := exporter.ValidateKeyspaceDBs(db); err != nil {
+			errs = append(errs, fmt.Errorf("keyspace_sample.dbs[%d]: %s", idx, err))
+		}
+	}
+	if c.KeyspaceSample.TopN < 0 {
+		errs = append(errs, fmt.Errorf("keyspace_sample.top_n: must not be negative"))
+	}
+	for i := 1; i < len(c.KeyspaceSample.Buckets); i++ {
+		if c.KeyspaceSample.Buckets[i] <= c.KeyspaceSample.Buckets[i-1] {
+			errs = append(errs, fmt.Errorf("keyspace_sample.buckets: must be increasing"))
+			break
+		}
+	}
+	for idx, k := range c.CheckGeoKeys {
+		if err := exporter.ValidateGeoCheckKeys(k); err != nil {
+			errs = append(errs, fmt.Errorf("check_geo_keys[%d]: %s", idx, err))
+		}
+	}
+	for idx, t := range c.Targets {
+		if t.Addr == "" {
+			errs = append(errs, fmt.Errorf("targets[%d].addr: missing address", idx))
+			continue
+		}
+		if err := exporter.ValidateAddr(t.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("targets[%d].addr: %s", idx, err))
+		}
+	}
+	names := map[string]bool{}
+	for idx, ic := range c.Instances {
+		if ic.Name == "" || names[ic.Name] {
+			errs = append(errs, fmt.Errorf("instances[%d].name: missing or duplicate name %q", idx, ic.Name))
+		}
+		names[ic.Name] = true
+		if ic.ListenAddress == "" {
+			errs = append(errs, fmt.Errorf("instances[%d].listen_address: missing listen address", idx))
+		}
+		if len(ic.Targets) == 0 {
+			errs = append(errs, fmt.Errorf("instances[%d].targets: no targets", idx))
+		}
+		for tidx, t := range ic.Targets {
+			if err := exporter.ValidateAddr(t.Addr); err != nil {
+				errs = append(errs, fmt.Errorf("instances[%d].targets[%d].addr: %s", idx, tidx, err))
+			}
+		}
+		for kidx, k := range ic.CheckKeys {
+			if err := exporter.ValidateCheckKeys(k); err != nil {
+				errs = append(errs, fmt.Errorf("instances[%d].check_keys[%d]: %s", idx, kidx, err))
+			}
+		}
+	}
+	for name, m := range c.Modules {
+		if m.Namespace != "" {
+			if err := exporter.ValidateNamespace(m.Namespace); err != nil {
+				errs = append(errs, fmt.Errorf("modules.%s.namespace: %s", name, err))
+			}
+		}
+		if err := exporter.ValidateSections(m.Sections); err != nil {
+			errs = append(errs, fmt.Errorf("modules.%s.sections: %s", name, err))
+		}
+		for idx, k := range m.CheckKeys {
+			if err := exporter.ValidateCheckKeys(k); err != nil {
+				errs = append(errs, fmt.Errorf("modules.%s.check_keys[%d]: %s", name, idx, err))
+			}
+		}
+		if m.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("modules.%s.timeout: must not be negative", name))
+		}
+	}
+	for _, t := range c.allTargets() {
+		if t.Mode != "" && t.Mode != "full" && t.Mode != "minimal" {
+			errs = append(errs, fmt.Errorf("mode of %s: must be full or minimal, not %q", exporter.RedactAddr(t.Addr), t.Mode))
+		}
+		if t.ConnectTimeout < 0 || t.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("timeouts of %s: must not be negative", exporter.RedactAddr(t.Addr)))
+		}
+	}
+	for _, t := range c.allTargets() {
+		if t.VaultPath != "" && c.Vault.Address == "" && os.Getenv("VAULT_ADDR") == "" {
+			errs = append(errs, fmt.Errorf("vault.address: missing address for the vault_path of %s", exporter.RedactAddr(t.Addr)))
+			break
+		}
+	}
+	for name, d := range c.MetricDescriptions {
+		if d.URL == "" {
+			continue
+		}
+		if u, err := url.Parse(d.URL); err != nil || !u.IsAbs() {
+			errs = append(errs, fmt.Errorf("metric_descriptions.%s.url: invalid URL %q", name, d.URL))
+		}
+	}
+	if _, err := c.TLS.build(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %s", err))
+	}
+	if _, err := parseTargetAllowlist(c.ScrapeAllowedTargets); err != nil {
+		errs = append(errs, fmt.Errorf("scrape_allowed_targets: %s", err))
+	}
+	if _, err := parseSourceAllowlist(c.WebAllowedSources); err != nil {
+		errs = append(errs, fmt.Errorf("web_allowed_sources: %s", err))
+	}
+	if _, err := c.WebTLS.build(); err != nil {
+		errs = append(errs, fmt.Errorf("web_tls: %s", err))
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		ratio := c.Tracing.SampleRatio
+		if ratio == 0 {
+			ratio = 1
+		}
+		if _, err := exporter.NewTracer(c.Tracing.OTLPEndpoint, c.Tracing.ServiceName, ratio); err != nil {
+			errs = append(errs, fmt.Errorf("tracing: %s", err))
+		}
+	}
+	if c.MetricsAllowlistFile != "" {
+		if _, err := loadMetricAllowlist(c.MetricsAllowlistFile); err != nil {
+			errs = append(errs, fmt.Errorf("metrics_allowlist_file: %s", err))
+		}
+	}
+	return errs
+}
+
+// tlsVersions are the valid values of min_version and --tls-min-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": 0x0304, // tls.VersionTLS13, which older go versions don't have
+}
+
+// build returns the tls.Config described by c, or nil if nothing is configured.
+func (c TLSConfig) build() (*tls.Config, error) {
+	if c == (TLSConfig{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify, ServerName: c.ServerName}
+
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("min_version: unknown TLS version %q, valid options are 1.0, 1.1, 1.2 and 1.3", c.MinVersion)
+		}
+		tlsConfig.MinVersion = v
+	}
+
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("ca_file: no certificates found in %s", c.CAFile)
+		}
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cert_file/key_file: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// metricDescriptions returns the HELP texts and documentation URLs of the
+// metric_descriptions section by metric name without namespace, as used by
+// exporter.Options.
+func (c *Config) metricDescriptions(namespace string) (map[string]string, map[string]string) {
+	help, urls := map[string]string{}, map[string]string{}
+	for name, d := range c.MetricDescriptions {
+		name = strings.TrimPrefix(name, namespace+"_")
+		if d.Help != "" {
+			help[name] = d.Help
+		}
+		if d.URL != "" {
+			urls[name] = d.URL
+		}
+	}
+	return help, urls
+}
+
+// addrs returns the target addresses and their passwords.
+func (c *Config) addrs() ([]string, []string) {
+	var addrs, passwords []string
+	for _, t := range c.Targets {
+		addrs = append(addrs, t.Addr)
+		passwords = append(passwords, t.Password)
+	}
+	return addrs, passwords
+}
+
+// aliases returns the aliases of all targets by address.
+func (c *Config) aliases() map[string]string {
+	res := map[string]string{}
+	for _, t := range c.allTargets() {
+		if t.Alias != "" {
+			res[t.Addr] = t.Alias
+		}
+	}
+	return res
+}
+
+// minimalTargets returns the addresses of all targets in minimal mode.
+func (c *Config) minimalTargets() map[string]bool {
+	res := map[string]bool{}
+	for _, t := range c.allTargets() {
+		if t.Mode == "minimal" {
+			res[t.Addr] = true
+		}
+	}
+	return res
+}
+
+// targetTimeouts returns the timeout overrides of all targets having some.
+func (c *Config) targetTimeouts() map[string]exporter.Timeouts {
+	res := map[string]exporter.Timeouts{}
+	for _, t := range c.allTargets() {
+		if t.ConnectTimeout > 0 || t.Timeout > 0 {
+			res[t.Addr] = exporter.Timeouts{Connect: t.ConnectTimeout, Command: t.Timeout}
+		}
+	}
+	return res
+}
+
+// allTargets returns the targets of the main exporter and all instances.
+func (c *Config) allTargets() []TargetConfig {
+	targets := append([]TargetConfig(nil), c.Targets...)
+	for _, ic := range c.Instances {
+		targets = append(targets, ic.Targets...)
+	}
+	return targets
+}
+
+// newInstance creates the exporter instance of ic, taking over all settings
+// it doesn't override from s and base, the settings and options of the main
+// instance.
+func (ic InstanceConfig) newInstance(s *settings, base exporter.Options, aliases map[string]string) (*instance, error) {
+	opts := base
+	if ic.Namespace != "" {
+		opts.Namespace = ic.Namespace
+	}
+	if len(ic.CheckKeys) > 0 {
+		opts.CheckKeys = strings.Join(ic.CheckKeys, ",")
+	}
+	opts.Limiter = exporter.NewScrapeLimiter(s.maxScrapes)
+
+	var addrs, passwords []string
+	for _, t := range ic.Targets {
+		addrs = append(addrs, t.Addr)
+		passwords = append(passwords, t.Password)
+	}
+	sh, err := parseShard(s.shardFlag)
+	if err != nil {
+		return nil, err
+	}
+	addrs, passwords = sh.filter(addrs, passwords)
+	inst, err := newInstance(ic.Name, addrs, passwords, opts, s)
+	if err != nil {
+		return nil, err
+	}
+	inst.aliases = aliases
+	return inst, nil
+}
+
+// checkConfig implements the check-config subcommand, it returns the process exit code.
+func checkConfig(fileName string) int {
+	cfg, err := loadConfig(fileName)
+	if err != nil {
+		fmt.Printf("FAILED: %s\n", err)
+		return 1
+	}
+	errs := cfg.validate()
+	for _, err := range errs {
+		fmt.Printf("FAILED: %s: %s\n", fileName, err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: OK, %d targets\n", fileName, len(cfg.Targets))
+	return 0
+}
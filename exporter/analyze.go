@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"sort"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// KeyAnalysis is the result of AnalyzeKeys.
+type KeyAnalysis struct {
+	DB          string    `json:"db"`
+	Pattern     string    `json:"pattern"`
+	Keys        int       `json:"keys"`
+	MemoryBytes int64     `json:"memory_bytes"`
+	Truncated   bool      `json:"truncated"`
+	Largest     []KeyInfo `json:"largest"`
+}
+
+type byMemory []KeyInfo
+
+func (s byMemory) Len() int           { return len(s) }
+func (s byMemory) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byMemory) Less(i, j int) bool { return s.lessThan(s[i], s[j]) }
+
+// lessThan returns whether a sorts before b, the bigger key first.
+func (byMemory) lessThan(a, b KeyInfo) bool {
+	if a.MemoryBytes != b.MemoryBytes {
+		return a.MemoryBytes > b.MemoryBytes
+	}
+	return a.Key < b.Key
+}
+
+// AnalyzeKeys SCANs db of the redis node addr for keys matching pattern,
+// looking at no more than limit keys, and returns their number, their total
+// memory usage and the top largest of them by memory usage.
+func (e *Exporter) AnalyzeKeys(addr, db, pattern string, limit, top int) (KeyAnalysis, error) {
+	res := KeyAnalysis{DB: db, Pattern: pattern, Largest: []KeyInfo{}}
+	c, err := e.connectToRedis(e.addrIndex(addr), addr)
+	if err != nil {
+		return res, err
+	}
+	defer c.Close()
+
+	info, err := redis.String(c.Do("INFO", "server"))
+	if err != nil {
+		return res, err
+	}
+	f := featuresOf(info)
+	if _, err := c.Do("SELECT", db); err != nil {
+		return res, err
+	}
+
+	var keys []KeyInfo
+	err = scanMatching(c, pattern, e.scanCount(), e.opts.ScanThrottle, func(key string) (bool, error) {
+		if res.Keys >= limit {
+			res.Truncated = true
+			return false, nil
+		}
+		res.Keys++
+		info := KeyInfo{DB: db, Key: key}
+		info.Type, _ = redis.String(c.Do("TYPE", key))
+		if cmd, ok := sizeCommands[info.Type]; ok {
+			info.Size, _ = redis.Int64(c.Do(cmd, key))
+		}
+		mem, _ := e.keyMemoryUsage(nil, c, f, key)
+		info.MemoryBytes = int64(mem)
+		res.MemoryBytes += int64(mem)
+		keys = append(keys, info)
+		return true, nil
+	})
+
+	sort.Sort(byMemory(keys))
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	res.Largest = append(res.Largest, keys...)
+	return res, err
+}
@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ScrapeInBackground scrapes the configured hosts every
+// Options.ScrapeInterval until stop is called, Collect serves the latest
+// results instead of querying redis. The first scrape of every host is
+// delayed by a phase derived from its address, spreading the hosts over the
+// interval instead of hitting all of them at the same instant, and every
+// interval is varied by Options.ScrapeJitter. Without a ScrapeInterval it
+// does nothing.
+func (e *Exporter) ScrapeInBackground() (stop func()) {
+	done := make(chan struct{})
+	if e.opts.ScrapeInterval <= 0 {
+		return func() {}
+	}
+	for idx, addr := range e.redis.Addrs {
+		go e.scrapeHostInBackground(idx, addr, done)
+	}
+	return func() { close(done) }
+}
+
+func (e *Exporter) scrapeHostInBackground(idx int, addr string, done <-chan struct{}) {
+	timer := time.NewTimer(scrapePhase(addr, e.opts.ScrapeInterval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		if _, err := e.refreshHost(idx, addr, nil); err != nil {
+			log.WithField("target", LabelAddr(addr)).WithError(err).Debug("background scrape failed")
+		}
+		timer.Reset(jittered(e.opts.ScrapeInterval, e.opts.ScrapeJitter, rand.Float64()))
+	}
+}
+
+// scrapePhase returns the offset of the first background scrape of addr
+// within interval, the same on every start of the exporter.
+func scrapePhase(addr string, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(addr))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// jittered returns interval shortened or prolonged by up to the fraction
+// jitter of it, r is a random number in [0, 1).
+func jittered(interval time.Duration, jitter, r float64) time.Duration {
+	return time.Duration(float64(interval) * (1 + jitter*(2*r-1)))
+}
+
+// backgroundCacheTTL returns how long the results of background scrapes are
+// served, two of the longest intervals so a slow or failed background
+// scrape doesn't leave Collect without results. 0 without background
+// scrapes.
+func backgroundCacheTTL(opts Options) time.Duration {
+	if opts.ScrapeInterval <= 0 {
+		return 0
+	}
+	return 2 * jittered(opts.ScrapeInterval, opts.ScrapeJitter, 1)
+}
@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	results []scrapeResult
+	err     error
+	created time.Time
+}
+
+// resultCache keeps the results of the last scrape of every redis host.
+type resultCache struct {
+	mtx     sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// get returns the cached entry for key if it's younger than ttl.
+func (c *resultCache) get(key string, ttl time.Duration) (cacheEntry, bool) {
+	if ttl <= 0 {
+		return cacheEntry{}, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.created) > ttl {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *resultCache) set(key string, results []scrapeResult, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	c.entries[key] = cacheEntry{results: results, err: err, created: time.Now()}
+}
+
+// clear drops all entries.
+func (c *resultCache) clear() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.entries = nil
+}
@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// seriesID identifies the series of a scrape result, the up metric sorts
+// first so it's never dropped.
+func seriesID(scr scrapeResult) string {
+	if scr.Name == "up" {
+		return ""
+	}
+	labels := scr.labels()
+	names := make([]string, 0, len(labels))
+	for l := range labels {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	id := scr.Name
+	for _, l := range names {
+		id += fmt.Sprintf(",%s=%q", l, labels[l])
+	}
+	return id
+}
+
+type bySeriesID []scrapeResult
+
+func (s bySeriesID) Len() int           { return len(s) }
+func (s bySeriesID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySeriesID) Less(i, j int) bool { return seriesID(s[i]) < seriesID(s[j]) }
+
+// limitSeries returns at most max of the results, keeping the same series
+// on every scrape: results are sorted by series and the overflow is dropped.
+func limitSeries(results []scrapeResult, max int) ([]scrapeResult, int) {
+	if max <= 0 || len(results) <= max {
+		return results, 0
+	}
+	sorted := append([]scrapeResult{}, results...)
+	sort.Stable(bySeriesID(sorted))
+	return sorted[:max], len(results) - max
+}
+
+// guardSeries applies Options.MaxSeriesPerTarget to the results of addr,
+// counting dropped series in exporter_series_dropped_total.
+func (e *Exporter) guardSeries(addr string, results []scrapeResult) []scrapeResult {
+	results, dropped := limitSeries(results, e.opts.MaxSeriesPerTarget)
+	if dropped > 0 {
+		log.WithField("target", LabelAddr(addr)).Warnf("dropped %d series, more than %d", dropped, e.opts.MaxSeriesPerTarget)
+		e.telemetryOf(addr).seriesDropped.WithLabelValues(LabelAddr(addr)).Add(float64(dropped))
+	}
+	return results
+}
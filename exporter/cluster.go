@@ -0,0 +1,335 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// clusterKeyspace sums up the keyspace metrics of all scraped cluster
+// masters, replicas are skipped as they hold copies of the same keys.
+type clusterKeyspace struct {
+	mtx      sync.Mutex
+	keys     map[string]float64
+	expiring map[string]float64
+}
+
+func newClusterKeyspace() *clusterKeyspace {
+	return &clusterKeyspace{keys: map[string]float64{}, expiring: map[string]float64{}}
+}
+
+// add adds the keyspace results of a single host if it's a cluster master.
+func (c *clusterKeyspace) add(results []scrapeResult) {
+	clusterEnabled, isMaster := false, false
+	for _, scr := range results {
+		switch scr.Name {
+		case "cluster_enabled":
+			clusterEnabled = scr.Value == 1
+		case "replication_is_master":
+			isMaster = scr.Value == 1
+		}
+	}
+	if !clusterEnabled || !isMaster {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, scr := range results {
+		switch scr.Name {
+		case "db_keys":
+			c.keys[scr.DB] += scr.Value
+		case "db_keys_expiring":
+			c.expiring[scr.DB] += scr.Value
+		}
+	}
+}
+
+// results returns the cluster wide totals, without an addr.
+func (c *clusterKeyspace) results() []scrapeResult {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	res := []scrapeResult{}
+	for db, v := range c.keys {
+		res = append(res, scrapeResult{Name: "cluster_db_keys", DB: db, Value: v})
+	}
+	for db, v := range c.expiring {
+		res = append(res, scrapeResult{Name: "cluster_db_keys_expiring", DB: db, Value: v})
+	}
+	return res
+}
+
+// ownedSlots returns all slots served by the node itself.
+func (n clusterNodes) ownedSlots() []int {
+	res := []int{}
+	for _, r := range n.slots {
+		if r.addr != n.myself {
+			continue
+		}
+		for slot := r.start; slot <= r.end; slot++ {
+			res = append(res, slot)
+		}
+	}
+	return res
+}
+
+// slotSampler keeps the sampled number of keys per slot of every cluster
+// master, a few slots are refreshed per scrape.
+type slotSampler struct {
+	mtx    sync.Mutex
+	next   map[string]int
+	counts map[string]map[int]int64
+}
+
+// sample refreshes the key count of up to n slots owned by the node addr
+// and sends the distribution across all sampled slots so far. The slots are
+// counted without holding s.mtx, so scrapes of other nodes don't wait on
+// this one.
+func (s *slotSampler) sample(c redis.Conn, addr string, nodes clusterNodes, n int, scrapes chan<- scrapeResult) {
+	owned := nodes.ownedSlots()
+	if len(owned) == 0 {
+		return
+	}
+
+	s.mtx.Lock()
+	if s.next == nil {
+		s.next = map[string]int{}
+		s.counts = map[string]map[int]int64{}
+	}
+	start := s.next[addr]
+	s.next[addr] = (start + n) % len(owned)
+	s.mtx.Unlock()
+
+	sampled := map[int]int64{}
+	for i := 0; i < n && i < len(owned); i++ {
+		slot := owned[(start+i)%len(owned)]
+		keys, err := redis.Int64(c.Do("CLUSTER", "COUNTKEYSINSLOT", slot))
+		if err != nil {
+			log.WithField("target", LabelAddr(addr)).WithError(err).Debug("CLUSTER COUNTKEYSINSLOT failed")
+			break
+		}
+		sampled[slot] = keys
+	}
+
+	ownedSet := map[int]bool{}
+	for _, slot := range owned {
+		ownedSet[slot] = true
+	}
+
+	s.mtx.Lock()
+	counts, ok := s.counts[addr]
+	if !ok {
+		counts = map[int]int64{}
+		s.counts[addr] = counts
+	}
+	// forget slots that moved to other nodes
+	for slot := range counts {
+		if !ownedSet[slot] {
+			delete(counts, slot)
+		}
+	}
+	for slot, keys := range sampled {
+		counts[slot] = keys
+	}
+	distribution := slotDistribution(counts)
+	s.mtx.Unlock()
+
+	for _, scr := range distribution {
+		scr.Addr = addr
+		scrapes <- scr
+	}
+}
+
+// slotDistribution returns min, max and average number of keys per slot.
+func slotDistribution(counts map[int]int64) []scrapeResult {
+	if len(counts) == 0 {
+		return nil
+	}
+	first := true
+	var min, max, sum int64
+	for _, keys := range counts {
+		if first || keys < min {
+			min = keys
+		}
+		if first || keys > max {
+			max = keys
+		}
+		first = false
+		sum += keys
+	}
+	return []scrapeResult{
+		{Name: "cluster_slots_sampled", Value: float64(len(counts))},
+		{Name: "cluster_slot_keys_min", Value: float64(min)},
+		{Name: "cluster_slot_keys_max", Value: float64(max)},
+		{Name: "cluster_slot_keys_avg", Value: float64(sum) / float64(len(counts))},
+	}
+}
+
+// parseClusterMessagesField parses per message type fields of CLUSTER INFO
+// like cluster_stats_messages_ping_sent, returning "sent" or "received" and
+// the message type.
+func parseClusterMessagesField(field string) (string, string, bool) {
+	if !strings.HasPrefix(field, "cluster_stats_messages_") {
+		return "", "", false
+	}
+	field = strings.TrimPrefix(field, "cluster_stats_messages_")
+	for _, kind := range []string{"sent", "received"} {
+		if msgType := strings.TrimSuffix(field, "_"+kind); msgType != field && msgType != "" {
+			return kind, msgType, true
+		}
+	}
+	return "", "", false
+}
+
+// keyHashSlot returns the cluster slot of key, respecting hash tags: if key
+// contains a non empty {...} section only that part is hashed.
+func keyHashSlot(key string) int {
+	if start := strings.Index(key, "{"); start != -1 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % 16384)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) as used for redis cluster slots.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type slotRange struct {
+	start, end int
+	addr       string
+}
+
+// clusterNodes is the slot assignment parsed from CLUSTER NODES.
+type clusterNodes struct {
+	myself string
+	slots  []slotRange
+}
+
+// parseClusterNodes parses the output of CLUSTER NODES, e.g.
+//
+//	07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+//	67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master - 0 1426238316232 2 connected 5461-10922
+//	e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460 [5461->-67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1]
+func parseClusterNodes(nodes string) clusterNodes {
+	res := clusterNodes{}
+	for _, line := range strings.Split(nodes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		addr := fields[1]
+		if i := strings.Index(addr, "@"); i != -1 {
+			addr = addr[:i]
+		}
+		if strings.Contains(fields[2], "myself") {
+			res.myself = addr
+		}
+		if !strings.Contains(fields[2], "master") {
+			continue
+		}
+		for _, slot := range fields[8:] {
+			if strings.HasPrefix(slot, "[") {
+				// slot being migrated or imported
+				continue
+			}
+			frags := strings.Split(slot, "-")
+			start, err := strconv.Atoi(frags[0])
+			if err != nil {
+				continue
+			}
+			end := start
+			if len(frags) == 2 {
+				if end, err = strconv.Atoi(frags[1]); err != nil {
+					continue
+				}
+			}
+			res.slots = append(res.slots, slotRange{start: start, end: end, addr: addr})
+		}
+	}
+	return res
+}
+
+// owner returns the address of the node serving slot, or "" if unknown.
+func (n clusterNodes) owner(slot int) string {
+	for _, r := range n.slots {
+		if slot >= r.start && slot <= r.end {
+			return r.addr
+		}
+	}
+	return ""
+}
+
+// hostPort returns the host:port part of a redis address.
+func hostPort(addr string) string {
+	if i := strings.Index(addr, "://"); i != -1 {
+		addr = addr[i+3:]
+	}
+	if i := strings.LastIndex(addr, "@"); i != -1 {
+		addr = addr[i+1:]
+	}
+	if i := strings.Index(addr, "/"); i != -1 {
+		addr = addr[:i]
+	}
+	return addr
+}
+
+// checkClusterKeys checks the configured keys against the cluster node addr
+// is connected to via c. Keys are checked on the node owning their slot: keys
+// owned by this node use c, keys owned by nodes that aren't scraped
+// themselves are checked by connecting to the owner, keys owned by other
+// scraped nodes are left to the scrape of that node. MOVED and ASK replies,
+// e.g. while resharding, are followed.
+func (e *Exporter) checkClusterKeys(c redis.Conn, idx int, addr string, f features, nodes clusterNodes) {
+	r := e.newRedirector(idx, addr)
+	defer r.close()
+
+	scraped := map[string]bool{}
+	for _, a := range e.redis.Addrs {
+		scraped[hostPort(a)] = true
+	}
+
+	for _, k := range e.checkKeys() {
+		if !k.checkedOn(addr) {
+			continue
+		}
+		if e.isGlob(k.key) {
+			// SCAN only returns the keys of this node
+			e.checkGlobKey(c, addr, f, k)
+			continue
+		}
+		owner := nodes.owner(keyHashSlot(k.key))
+		if owner == "" || owner == nodes.myself || owner == hostPort(addr) {
+			e.checkKey(r, c, addr, f, k)
+			continue
+		}
+		if scraped[owner] && k.addr == "" {
+			// keys scoped to this node are checked on the owner anyway
+			continue
+		}
+
+		oc, err := r.conn(owner)
+		if err != nil {
+			log.WithField("target", LabelAddr(owner)).WithError(err).Debug("couldn't connect to key owner")
+			continue
+		}
+		e.checkKey(r, oc, addr, f, k)
+	}
+}
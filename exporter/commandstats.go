@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"sort"
+	"strings"
+)
+
+// commandStat holds the parsed cmdstat_<cmd> line of INFO commandstats.
+type commandStat struct {
+	cmd   string
+	calls float64
+	usec  float64
+}
+
+// topCommandStats returns the n commands with the most calls, all other
+// commands are summed up into a single "other" entry.
+func topCommandStats(stats []commandStat, n int) []commandStat {
+	if n <= 0 || len(stats) <= n {
+		return stats
+	}
+
+	sorted := make(byCalls, len(stats))
+	copy(sorted, stats)
+	sort.Sort(sorted)
+
+	res := sorted[:n]
+	other := commandStat{cmd: "other"}
+	for _, st := range sorted[n:] {
+		other.calls += st.calls
+		other.usec += st.usec
+	}
+	return append(res, other)
+}
+
+// ParseCommands parses the comma separated command list of
+// Options.CommandStatsCommands, the commands are lowercased.
+func ParseCommands(s string) []string {
+	var cmds []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+// commandListed returns true if cmd or, for subcommands like config|get,
+// its parent command is one of commands.
+func commandListed(commands []string, cmd string) bool {
+	cmd = strings.ToLower(cmd)
+	parent := strings.SplitN(cmd, "|", 2)[0]
+	for _, c := range commands {
+		if c == cmd || c == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// selectCommandStats returns the stats of the listed commands (all if
+// commands is empty) limited to the n most called, see topCommandStats. All
+// other commands are summed up into a single "other" entry.
+func selectCommandStats(stats []commandStat, commands []string, n int) []commandStat {
+	if len(commands) == 0 {
+		return topCommandStats(stats, n)
+	}
+	var listed []commandStat
+	other := commandStat{cmd: "other"}
+	for _, st := range stats {
+		if commandListed(commands, st.cmd) {
+			listed = append(listed, st)
+			continue
+		}
+		other.calls += st.calls
+		other.usec += st.usec
+	}
+	if len(listed) == len(stats) {
+		return topCommandStats(stats, n)
+	}
+	res := topCommandStats(listed, n)
+	if n > 0 && len(listed) > n {
+		// the least called listed commands are already summed up as other
+		res[n].calls += other.calls
+		res[n].usec += other.usec
+		return res
+	}
+	return append(res, other)
+}
+
+// byCalls sorts command stats by number of calls, most called first.
+type byCalls []commandStat
+
+func (s byCalls) Len() int      { return len(s) }
+func (s byCalls) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCalls) Less(i, j int) bool {
+	if s[i].calls != s[j].calls {
+		return s[i].calls > s[j].calls
+	}
+	return s[i].cmd < s[j].cmd
+}
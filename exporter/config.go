@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// scrapeConfig sends the metrics of the configuration settings of the node
+// c is connected to, isCluster tells if it runs in cluster mode. Settings
+// CONFIG GET fails for, e.g. because CONFIG is renamed, are skipped. The
+// CONFIG GET commands are pipelined if pipeline is set.
+func scrapeConfig(c redis.Conn, addr string, isCluster, pipeline bool, scrapes chan<- scrapeResult) {
+	var b cmdBatch
+	get := func(setting string) *batchCmd {
+		return b.add("CONFIG", "GET", setting)
+	}
+	mode := map[string]*batchCmd{"appendonly": get("appendonly"), "databases": get("databases"), "io_threads": get("io-threads")}
+	maxmemory, latency, notify, save := get("maxmemory"), get("latency-monitor-threshold"), get("notify-keyspace-events"), get("save")
+	if err := b.run(nil, c, pipeline); err != nil {
+		log.WithField("target", LabelAddr(addr)).WithError(err).Debug("CONFIG GET failed")
+		return
+	}
+
+	scrapes <- scrapeResult{Name: "server_mode_info", Addr: addr, Value: 1, Labels: serverMode(mode, isCluster)}
+
+	if config, err := redis.Strings(maxmemory.reply, maxmemory.err); err == nil {
+		extractConfigMetrics(config, addr, scrapes)
+	}
+
+	if config, err := redis.Strings(latency.reply, latency.err); err == nil && len(config) == 2 {
+		extractConfigMetrics(config, addr, scrapes)
+		enabled := 0.0
+		if threshold, err := strconv.ParseFloat(config[1], 64); err == nil && threshold > 0 {
+			enabled = 1
+		}
+		scrapes <- scrapeResult{Name: "latency_monitoring_enabled", Addr: addr, Value: enabled}
+	}
+
+	if config, err := redis.Strings(notify.reply, notify.err); err == nil && len(config) == 2 {
+		scrapes <- scrapeResult{Name: "config_notify_keyspace_events_info", Addr: addr, Value: 1, Labels: map[string]string{"flags": config[1]}}
+	}
+
+	if config, err := redis.Strings(save.reply, save.err); err == nil && len(config) == 2 {
+		points, ok := parseSavePoints(config[1])
+		if !ok {
+			log.WithField("target", LabelAddr(addr)).Debugf("couldn't parse save config %q", config[1])
+			return
+		}
+		scrapes <- scrapeResult{Name: "config_save_points", Addr: addr, Value: float64(len(points))}
+		for idx, p := range points {
+			labels := map[string]string{"point": strconv.Itoa(idx)}
+			scrapes <- scrapeResult{Name: "config_save_seconds", Addr: addr, Value: p[0], Labels: labels}
+			scrapes <- scrapeResult{Name: "config_save_changes", Addr: addr, Value: p[1], Labels: labels}
+		}
+	}
+}
+
+// parseSavePoints parses the save setting, e.g. "3600 1 300 100", into
+// (seconds, changes) pairs. An empty setting, RDB snapshots disabled, has
+// no save points.
+func parseSavePoints(save string) ([][2]float64, bool) {
+	fields := strings.Fields(save)
+	if len(fields)%2 != 0 {
+		return nil, false
+	}
+	points := [][2]float64{}
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, false
+		}
+		changes, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return nil, false
+		}
+		points = append(points, [2]float64{seconds, changes})
+	}
+	return points, true
+}
+
+// serverMode returns the labels of server_mode_info, a fingerprint of the
+// operating mode of the node, from the CONFIG GET commands of the settings
+// by label. Settings that can't be read are "unknown", io_threads is "1" on
+// versions without I/O threads, which don't know the setting.
+func serverMode(settings map[string]*batchCmd, isCluster bool) map[string]string {
+	mode := map[string]string{"cluster_enabled": "0", "appendonly": "unknown", "databases": "unknown", "io_threads": "unknown"}
+	if isCluster {
+		mode["cluster_enabled"] = "1"
+	}
+	for label, cmd := range settings {
+		config, err := redis.Strings(cmd.reply, cmd.err)
+		if err == nil && len(config) == 2 {
+			mode[label] = config[1]
+		} else if err == nil && len(config) == 0 && label == "io_threads" {
+			mode[label] = "1"
+		}
+	}
+	return mode
+}
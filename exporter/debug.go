@@ -0,0 +1,40 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// DumpInfo writes the raw INFO response of the redis node addr to w, each line
+// followed by how it was mapped: kept, renamed or skipped (and why).
+func (e *Exporter) DumpInfo(addr string, w io.Writer) error {
+	c, err := e.connectToRedis(e.addrIndex(addr), addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	info, err := redis.String(c.Do("INFO", e.infoSection(addr)))
+	if err != nil {
+		return err
+	}
+
+	// results are only needed for the trace, drain and drop them
+	scrapes := make(chan scrapeResult)
+	done := make(chan struct{})
+	go func() {
+		for range scrapes {
+		}
+		close(done)
+	}()
+
+	fmt.Fprintf(w, "# INFO %s of %s\n", e.infoSection(addr), LabelAddr(addr))
+	e.extractInfoMetricsTraced(info, addr, scrapes, func(line, action string) {
+		fmt.Fprintf(w, "%-60s -> %s\n", line, action)
+	})
+	close(scrapes)
+	<-done
+	return nil
+}
@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// counterDeltas keeps the last value of the counters per host, to export
+// their increase since the previous scrape for push based sinks (StatsD,
+// Kafka, remote write ...) expecting deltas instead of cumulative values.
+type counterDeltas struct {
+	mtx  sync.Mutex
+	last map[string]map[string]float64
+}
+
+// seriesKey identifies the series of scr among the results of its host.
+func seriesKey(scr scrapeResult) string {
+	parts := []string{scr.Namespace, scr.Name, scr.DB, scr.Cmd}
+	names := make([]string, 0, len(scr.Labels))
+	for name := range scr.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+scr.Labels[name])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// withDeltas returns results with the values of the counters replaced by
+// their increase since the previous scrape of addr served, so results served
+// again from the cache have deltas of 0. Counters seen for the
+// first time are left out, a value lower than the last one is a counter
+// reset and exported as is.
+func (e *Exporter) withDeltas(addr string, results []scrapeResult) []scrapeResult {
+	if !e.opts.Deltas {
+		return results
+	}
+	d := &e.deltas
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.last == nil {
+		d.last = map[string]map[string]float64{}
+	}
+	prev, next := d.last[addr], map[string]float64{}
+	deltas := make([]scrapeResult, 0, len(results))
+	for _, scr := range results {
+		if scr.Addr != addr || describeMetric(scr.Name).typ != counterMetric {
+			deltas = append(deltas, scr)
+			continue
+		}
+		key := seriesKey(scr)
+		next[key] = scr.Value
+		last, ok := prev[key]
+		if !ok {
+			continue
+		}
+		if scr.Value >= last {
+			scr.Value -= last
+		}
+		deltas = append(deltas, scr)
+	}
+	d.last[addr] = next
+	return deltas
+}
@@ -0,0 +1,75 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geoRadius is the area checked geo keys count their members in.
+type geoRadius struct {
+	lon, lat, radius float64
+	unit             string
+}
+
+// parseGeoRadius parses <lon>:<lat>:<radius><unit>, e.g. 13.361389:38.115556:5km,
+// unit is one of m, km, mi and ft.
+func parseGeoRadius(s string) (*geoRadius, error) {
+	frags := strings.Split(s, ":")
+	if len(frags) != 3 {
+		return nil, fmt.Errorf("invalid radius %q, expected <lon>:<lat>:<radius><unit>", s)
+	}
+	lon, err := strconv.ParseFloat(frags[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", frags[0])
+	}
+	lat, err := strconv.ParseFloat(frags[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", frags[1])
+	}
+	for _, unit := range []string{"km", "mi", "ft", "m"} {
+		if !strings.HasSuffix(frags[2], unit) {
+			continue
+		}
+		radius, err := strconv.ParseFloat(strings.TrimSuffix(frags[2], unit), 64)
+		if err != nil || radius < 0 {
+			return nil, fmt.Errorf("invalid radius %q", frags[2])
+		}
+		return &geoRadius{lon: lon, lat: lat, radius: radius, unit: unit}, nil
+	}
+	return nil, fmt.Errorf("invalid radius %q, unit must be one of m, km, mi and ft", frags[2])
+}
+
+// parseGeoCheckKey parses a single check-geo-keys entry of the form
+// [db<n>=]<key>[@<lon>:<lat>:<radius><unit>].
+func parseGeoCheckKey(k string) (dbKeyPair, error) {
+	var radius *geoRadius
+	if i := strings.LastIndex(k, "@"); i != -1 {
+		var err error
+		if radius, err = parseGeoRadius(strings.TrimSpace(k[i+1:])); err != nil {
+			return dbKeyPair{}, err
+		}
+		k = k[:i]
+	}
+	pair, err := parseCheckKey(k)
+	if err != nil {
+		return dbKeyPair{}, err
+	}
+	pair.geo = true
+	pair.radius = radius
+	return pair, nil
+}
+
+// ValidateGeoCheckKeys returns an error describing the first malformed entry
+// of a comma separated check-geo-keys list.
+func ValidateGeoCheckKeys(checkKeys string) error {
+	for idx, k := range strings.Split(checkKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		if _, err := parseGeoCheckKey(k); err != nil {
+			return fmt.Errorf("entry %d: %s", idx, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// hashFieldTTL are the fields of a hash whose TTLs (hash field expiration,
+// redis 7.4) are exported.
+type hashFieldTTL struct {
+	fields []string
+}
+
+// merge returns the fields of h and other.
+func (h *hashFieldTTL) merge(other *hashFieldTTL) *hashFieldTTL {
+	if h == nil {
+		return other
+	}
+	return &hashFieldTTL{fields: appendMissing(append([]string{}, h.fields...), other.fields...)}
+}
+
+// parseHashFieldTTLKey parses a single check-hash-field-ttl-keys entry of the
+// form [db<n>=]<key>@<field>[:<field>...], the fields may be url encoded.
+func parseHashFieldTTLKey(k string) (dbKeyPair, error) {
+	i := strings.LastIndex(k, "@")
+	if i == -1 {
+		return dbKeyPair{}, fmt.Errorf("missing fields in %q, expected <key>@<field>[:<field>...]", k)
+	}
+	ttl := &hashFieldTTL{}
+	for _, f := range strings.Split(strings.TrimSpace(k[i+1:]), ":") {
+		field, err := url.QueryUnescape(f)
+		if err != nil {
+			return dbKeyPair{}, err
+		}
+		if field == "" {
+			return dbKeyPair{}, fmt.Errorf("empty field in %q", k)
+		}
+		ttl.fields = append(ttl.fields, field)
+	}
+	pair, err := parseCheckKey(k[:i])
+	if err != nil {
+		return dbKeyPair{}, err
+	}
+	pair.fieldTTL = ttl
+	return pair, nil
+}
+
+// ValidateHashFieldTTLKeys returns an error describing the first malformed
+// entry of a comma separated check-hash-field-ttl-keys list.
+func ValidateHashFieldTTLKeys(checkKeys string) error {
+	for idx, k := range strings.Split(checkKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		if _, err := parseHashFieldTTLKey(k); err != nil {
+			return fmt.Errorf("entry %d: %s", idx, err)
+		}
+	}
+	return nil
+}
+
+// hpttlArgs returns the arguments of HPTTL for the fields of k.
+func hpttlArgs(k dbKeyPair) []interface{} {
+	args := []interface{}{k.key, "FIELDS", len(k.fieldTTL.fields)}
+	for _, f := range k.fieldTTL.fields {
+		args = append(args, f)
+	}
+	return args
+}
+
+// setFieldTTLs exports the HPTTL reply pttls of the fields of k to m. Fields
+// that don't exist (-2) have no TTL and their series are dropped.
+func (e *Exporter) setFieldTTLs(m *keyMetrics, k dbKeyPair, pttls []int64) {
+	for i, pttl := range pttls {
+		if i >= len(k.fieldTTL.fields) {
+			break
+		}
+		field := k.fieldTTL.fields[i]
+		if ttl, ok := keyTTLSeconds(pttl); ok {
+			m.keyFieldTTL.WithLabelValues(k.labels(field)...).Set(ttl)
+		} else {
+			m.keyFieldTTL.DeleteLabelValues(k.labels(field)...)
+		}
+	}
+}
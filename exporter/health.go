@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+)
+
+// scrapeProgress tracks running scrapes to detect a wedged exporter.
+type scrapeProgress struct {
+	mtx          sync.Mutex
+	inFlight     int
+	lastProgress time.Time
+}
+
+func (p *scrapeProgress) start() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.inFlight == 0 {
+		p.lastProgress = time.Now()
+	}
+	p.inFlight++
+}
+
+func (p *scrapeProgress) done() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.inFlight--
+	p.lastProgress = time.Now()
+}
+
+func (p *scrapeProgress) stalled(timeout time.Duration) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.inFlight > 0 && time.Since(p.lastProgress) > timeout
+}
+
+// ScrapeStalled returns true if scrapes are running but none of them
+// started or finished within timeout.
+func (e *Exporter) ScrapeStalled(timeout time.Duration) bool {
+	return e.progress.stalled(timeout)
+}
+
+// Ping connects to the redis node addr and sends a PING.
+func (e *Exporter) Ping(addr string) error {
+	c, err := e.connectToRedis(e.addrIndex(addr), addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Do("PING")
+	return err
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseLatencyStats parses a line of the Latencystats section of redis 7,
+// e.g. latency_percentiles_usec_get:p50=1.003,p99=2.007,p99.9=3.007, into
+// the command and its latency in seconds by quantile ("0.5", "0.99", ...).
+func parseLatencyStats(field, value string) (string, map[string]float64, bool) {
+	if !strings.HasPrefix(field, "latency_percentiles_usec_") {
+		return "", nil, false
+	}
+	cmd := strings.TrimPrefix(field, "latency_percentiles_usec_")
+	quantiles := map[string]float64{}
+	for _, frag := range strings.Split(value, ",") {
+		kv := strings.SplitN(frag, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "p") {
+			return "", nil, false
+		}
+		p, err := strconv.ParseFloat(kv[0][1:], 64)
+		if err != nil {
+			return "", nil, false
+		}
+		usec, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return "", nil, false
+		}
+		quantiles[strconv.FormatFloat(p/100, 'g', 6, 64)] = usec / 1e6
+	}
+	return cmd, quantiles, true
+}
+
+// parseErrorStats parses a line of the Errorstats section of redis 6.2 and
+// newer, e.g. errorstat_WRONGTYPE:count=3, into the error prefix and count.
+func parseErrorStats(field, value string) (string, float64, bool) {
+	if !strings.HasPrefix(field, "errorstat_") || !strings.HasPrefix(value, "count=") {
+		return "", 0, false
+	}
+	count, err := strconv.ParseFloat(strings.TrimPrefix(value, "count="), 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.TrimPrefix(field, "errorstat_"), count, true
+}
+
+// memoryUsage collects the INFO fields memory_used_percent is derived from.
+type memoryUsage struct {
+	used, max float64
+	seen      bool
+}
+
+// add records the field name of the Memory section if it's one of the
+// fields of m.
+func (m *memoryUsage) add(name string, val float64) {
+	switch name {
+	case "used_memory":
+		m.used, m.seen = val, true
+	case "maxmemory", "max_memory":
+		m.max = val
+	}
+}
+
+// percent returns used_memory as percentage of maxmemory, ok is false
+// without a maxmemory limit (or before redis 3.2, which doesn't report it).
+func (m memoryUsage) percent() (float64, bool) {
+	if !m.seen || m.max <= 0 {
+		return 0, false
+	}
+	return m.used / m.max * 100, true
+}
+
+// discoveredFieldPrefix is the prefix of the metrics of unknown INFO fields,
+// see Options.DiscoverInfoFields.
+const discoveredFieldPrefix = "info_"
+
+// discoveredFieldName returns the metric name of the unknown INFO field.
+func discoveredFieldName(field string) string {
+	return discoveredFieldPrefix + sanitizeMetricName(strings.ToLower(field))
+}
+
+// sections of INFO counted by exporter_parse_failures_total
+const (
+	parseSectionInfo         = "info"
+	parseSectionKeyspace     = "keyspace"
+	parseSectionCommandStats = "commandstats"
+	parseSectionLatencyStats = "latencystats"
+	parseSectionErrorStats   = "errorstats"
+)
+
+// parseSectionOf returns the section counting the parse failures of the
+// exported INFO field.
+func parseSectionOf(field string) string {
+	switch {
+	case strings.HasPrefix(field, "cmdstat_"):
+		return parseSectionCommandStats
+	case strings.HasPrefix(field, "db"):
+		return parseSectionKeyspace
+	}
+	return parseSectionInfo
+}
@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// keyGroup is a db whose keys are counted per prefix.
+type keyGroup struct {
+	db       string
+	prefixes []string
+}
+
+// parseKeyGroups parses a ; separated list of [db<n>=]<prefix>,<prefix>...
+// entries, e.g. db0=user:,session:;db3=cache:
+func parseKeyGroups(s string) ([]keyGroup, error) {
+	var groups []keyGroup
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		db, prefixes := "0", entry
+		if frags := strings.SplitN(entry, "=", 2); len(frags) == 2 {
+			db, prefixes = strings.TrimPrefix(strings.TrimSpace(frags[0]), "db"), frags[1]
+		}
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid db %q in %q", db, entry)
+		}
+		g := keyGroup{db: db}
+		for _, p := range strings.Split(prefixes, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				g.prefixes = append(g.prefixes, p)
+			}
+		}
+		if len(g.prefixes) == 0 {
+			return nil, fmt.Errorf("no prefixes in %q", entry)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// ValidateKeyGroups returns an error if s isn't a valid --count-key-groups value.
+func ValidateKeyGroups(s string) error {
+	_, err := parseKeyGroups(s)
+	return err
+}
+
+// matchPrefix returns the longest of prefixes key starts with.
+func matchPrefix(key string, prefixes []string) (string, bool) {
+	match, ok := "", false
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) && len(p) >= len(match) {
+			match, ok = p, true
+		}
+	}
+	return match, ok
+}
+
+// escapeGlob escapes the characters SCAN MATCH treats as glob patterns.
+func escapeGlob(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// countKeyGroups SCANs the configured dbs and sends the number of keys and
+// their memory usage per prefix. With Options.ScanChunk set a chunk of the
+// db is SCANned per scrape and the counts of the last complete pass are sent.
+func (e *Exporter) countKeyGroups(c redis.Conn, addr string, f features, scrapes chan<- scrapeResult) {
+	if !f.scan {
+		log.WithField("target", LabelAddr(addr)).Debug("SCAN not supported, not counting key groups")
+		return
+	}
+	for _, g := range e.keyGroups {
+		entry := log.WithFields(log.Fields{"target": LabelAddr(addr), "db": g.db})
+		if _, err := c.Do("SELECT", g.db); err != nil {
+			entry.WithError(err).Debug("SELECT failed")
+			continue
+		}
+
+		pattern := "*"
+		if len(g.prefixes) == 1 {
+			pattern = escapeGlob(g.prefixes[0]) + "*"
+		}
+		keys := map[string]float64{}
+		memory := map[string]float64{}
+		count := func(key string) {
+			prefix, ok := matchPrefix(key, g.prefixes)
+			if !ok {
+				return
+			}
+			keys[prefix]++
+			if mem, ok := e.keyMemoryUsage(nil, c, f, key); ok {
+				memory[prefix] += mem
+			}
+		}
+		if e.opts.ScanChunk > 0 {
+			st := e.scans.get(addr, "key-groups", g.db)
+			if st.keys == nil {
+				st.keys, st.memory = map[string]float64{}, map[string]float64{}
+			}
+			keys, memory = st.keys, st.memory
+			cursor, err := scanChunk(c, pattern, e.scanCount(), e.opts.ScanThrottle, st.cursor, e.opts.ScanChunk, count)
+			if err != nil {
+				entry.WithError(err).Debug("SCAN failed")
+				// start the pass over
+				st.cursor, st.keys, st.memory = 0, nil, nil
+				continue
+			}
+			if st.cursor = cursor; cursor == 0 {
+				st.lastKeys, st.lastMemory = st.keys, st.memory
+				st.keys, st.memory = nil, nil
+			}
+			if st.lastKeys == nil {
+				entry.Debug("first key group SCAN pass not complete yet")
+				continue
+			}
+			keys, memory = st.lastKeys, st.lastMemory
+		} else {
+			err := scanMatching(c, pattern, e.scanCount(), e.opts.ScanThrottle, func(key string) (bool, error) {
+				count(key)
+				return true, nil
+			})
+			if err != nil {
+				entry.WithError(err).Debug("SCAN failed")
+				continue
+			}
+		}
+
+		prefixes := append([]string{}, g.prefixes...)
+		sort.Strings(prefixes)
+		for _, p := range prefixes {
+			labels := map[string]string{"prefix": p}
+			scrapes <- scrapeResult{Name: "key_group_keys", Addr: addr, DB: "db" + g.db, Labels: labels, Value: keys[p]}
+			scrapes <- scrapeResult{Name: "key_group_memory_usage_bytes", Addr: addr, DB: "db" + g.db, Labels: labels, Value: memory[p]}
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxKeyRedirects bounds the number of MOVED/ASK redirects followed per command.
+const maxKeyRedirects = 5
+
+// redirector follows MOVED and ASK replies of cluster nodes, connecting to
+// the nodes it's sent to with the settings of the scraped node.
+type redirector struct {
+	e     *Exporter
+	idx   int
+	addr  string
+	conns map[string]redis.Conn
+}
+
+func (e *Exporter) newRedirector(idx int, addr string) *redirector {
+	return &redirector{e: e, idx: idx, addr: addr, conns: map[string]redis.Conn{}}
+}
+
+// conn returns a connection to the cluster node addr (host:port), reusing
+// connections opened before. Cluster nodes share the password of the
+// scraped node, also if it's part of its URL.
+func (r *redirector) conn(addr string) (redis.Conn, error) {
+	if c, ok := r.conns[addr]; ok {
+		return c, nil
+	}
+	c, err := r.e.connectToRedis(r.idx, peerAddr(r.addr, addr))
+	if err != nil {
+		return nil, err
+	}
+	r.conns[addr] = c
+	return c, nil
+}
+
+// do sends cmd on c, following up to maxKeyRedirects MOVED or ASK replies.
+// A nil redirector sends cmd on c only.
+func (r *redirector) do(c redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	if r == nil {
+		return c.Do(cmd, args...)
+	}
+
+	asking := false
+	for i := 0; ; i++ {
+		if asking {
+			if _, err := c.Do("ASKING"); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := c.Do(cmd, args...)
+		kind, addr, ok := parseRedirect(err)
+		if !ok || i >= maxKeyRedirects {
+			return reply, err
+		}
+
+		log.WithField("target", LabelAddr(addr)).Debugf("following %s redirect for %s", kind, cmd)
+		if c, err = r.conn(addr); err != nil {
+			return nil, err
+		}
+		asking = kind == "ASK"
+	}
+}
+
+func (r *redirector) close() {
+	for _, c := range r.conns {
+		c.Close()
+	}
+}
+
+// parseRedirect returns the kind (MOVED or ASK) and the target address of a
+// cluster redirect error like "MOVED 3999 127.0.0.1:6381".
+func parseRedirect(err error) (string, string, bool) {
+	rerr, ok := err.(redis.Error)
+	if !ok {
+		return "", "", false
+	}
+	frags := strings.Fields(string(rerr))
+	if len(frags) != 3 || (frags[0] != "MOVED" && frags[0] != "ASK") {
+		return "", "", false
+	}
+	return frags[0], frags[2], true
+}
+
+// keyTypeSizeMetrics maps a key type to the name and help of the metric
+// exporting the size returned by its sizeCommands entry.
+var keyTypeSizeMetrics = map[string][2]string{
+	"string": {"key_string_length_bytes", "The length in bytes of the string \"key\""},
+	"list":   {"key_list_length", "The number of elements of the list \"key\""},
+	"set":    {"key_set_cardinality", "The number of members of the set \"key\""},
+	"zset":   {"key_zset_cardinality", "The number of members of the sorted set \"key\""},
+	"hash":   {"key_hash_fields", "The number of fields of the hash \"key\""},
+	"stream": {"key_stream_length", "The number of entries of the stream \"key\""},
+}
+
+// keyMetrics are the metrics of the checked keys of the targets exported
+// under one namespace.
+type keyMetrics struct {
+	keyValues          *prometheus.GaugeVec
+	keySizes           *prometheus.GaugeVec
+	keyMemory          *prometheus.GaugeVec
+	keyBits            *prometheus.GaugeVec
+	keyHLL             *prometheus.GaugeVec
+	keyGeo             *prometheus.GaugeVec
+	keyGeoRadius       *prometheus.GaugeVec
+	keyTypeSizes       map[string]*prometheus.GaugeVec
+	keyTTL             *prometheus.GaugeVec
+	keyValueInfo       *valueLabels
+	keyHashField       *hashFieldValues
+	keyFieldTTL        *prometheus.GaugeVec
+	keyMembersMatching *prometheus.GaugeVec
+	keysTrunc          *prometheus.GaugeVec
+}
+
+func newKeyMetrics(namespace string, opts Options) *keyMetrics {
+	m := &keyMetrics{
+		keyValues: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_value",
+			Help:      helpText(opts, "key_value", "The value of \"key\""),
+		}, []string{"db", "key"}),
+		keySizes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_size",
+			Help:      helpText(opts, "key_size", "The length or size of \"key\""),
+		}, []string{"db", "key"}),
+		keyMemory: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_memory_usage_bytes",
+			Help:      helpText(opts, "key_memory_usage_bytes", "The memory used by \"key\" according to MEMORY USAGE"),
+		}, []string{"db", "key"}),
+		keyBits: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_bits_set",
+			Help:      helpText(opts, "key_bits_set", "The number of bits set in the bitmap \"key\""),
+		}, []string{"db", "key"}),
+		keyHLL: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_hll_cardinality",
+			Help:      helpText(opts, "key_hll_cardinality", "The estimated cardinality of the HyperLogLog \"key\""),
+		}, []string{"db", "key"}),
+		keyGeo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_geo_members",
+			Help:      helpText(opts, "key_geo_members", "The number of members of the geo set \"key\""),
+		}, []string{"db", "key"}),
+		keyGeoRadius: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_geo_members_in_radius",
+			Help:      helpText(opts, "key_geo_members_in_radius", "The number of members of the geo set \"key\" within the configured radius"),
+		}, []string{"db", "key"}),
+		keyValueInfo: &valueLabels{vec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_value_info",
+			Help:      helpText(opts, "key_value_info", "Always 1, the value of \"key\" is the value label"),
+		}, []string{"db", "key", "value"})},
+		keyHashField: &hashFieldValues{vec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_hash_field_value",
+			Help:      helpText(opts, "key_hash_field_value", "The value of the numeric field \"field\" of the hash \"key\""),
+		}, []string{"db", "key", "field"})},
+		keyFieldTTL: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_hash_field_ttl_seconds",
+			Help:      helpText(opts, "key_hash_field_ttl_seconds", "The time to live of the field \"field\" of the hash \"key\", -1 if it doesn't expire"),
+		}, []string{"db", "key", "field"}),
+		keyMembersMatching: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_members_matching",
+			Help:      helpText(opts, "key_members_matching", "The number of members of the set or sorted set \"key\" matching \"pattern\""),
+		}, []string{"db", "key", "pattern"}),
+		keysTrunc: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "keys_truncated",
+			Help:      helpText(opts, "keys_truncated", "1 if the check-keys pattern matched more keys than the limit and only some of them were checked"),
+		}, []string{"db", "pattern"}),
+		keyTTL: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "key_ttl_seconds",
+			Help:      helpText(opts, "key_ttl_seconds", "The time to live of \"key\", -1 if it doesn't expire"),
+		}, []string{"db", "key"}),
+	}
+	m.keyTypeSizes = map[string]*prometheus.GaugeVec{}
+	for typ, t := range keyTypeSizeMetrics {
+		m.keyTypeSizes[typ] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      t[0],
+			Help:      helpText(opts, t[0], t[1]),
+		}, []string{"db", "key"})
+	}
+	return m
+}
+
+// vecs returns the metric vectors of m but the ones of keyValueInfo and
+// keyHashField.
+func (m *keyMetrics) vecs() []*prometheus.GaugeVec {
+	vecs := []*prometheus.GaugeVec{m.keySizes, m.keyValues, m.keyMemory, m.keyBits, m.keyHLL, m.keyGeo, m.keyGeoRadius, m.keyTTL, m.keyFieldTTL, m.keyMembersMatching, m.keysTrunc}
+	for _, vec := range m.keyTypeSizes {
+		vecs = append(vecs, vec)
+	}
+	return vecs
+}
+
+func (m *keyMetrics) describe(ch chan<- *prometheus.Desc) {
+	for _, vec := range m.vecs() {
+		vec.Describe(ch)
+	}
+	m.keyValueInfo.vec.Describe(ch)
+	m.keyHashField.vec.Describe(ch)
+}
+
+func (m *keyMetrics) collect(ch chan<- prometheus.Metric) {
+	for _, vec := range m.vecs() {
+		vec.Collect(ch)
+	}
+	m.keyValueInfo.vec.Collect(ch)
+	m.keyHashField.vec.Collect(ch)
+}
+
+// reset drops the series of all checked keys.
+func (m *keyMetrics) reset() {
+	for _, vec := range m.vecs() {
+		vec.Reset()
+	}
+	m.keyValueInfo.reset()
+	m.keyHashField.reset()
+}
+
+// checkKey exports the value and length/size of k using connection c,
+// following cluster redirects via r (which may be nil), under the namespace
+// of the scraped node addr. f are the features of the node c is connected
+// to.
+func (e *Exporter) checkKey(r *redirector, c redis.Conn, addr string, f features, k dbKeyPair) {
+	e.checkKeyList(r, c, addr, f, []dbKeyPair{k})
+}
+
+// keyCmds are the commands checking a key.
+type keyCmds struct {
+	sel, get, typ, pttl, bits, geo, radius, mem, fieldTTL *batchCmd
+	// depending on the type
+	size, hll *batchCmd
+	typeName  string
+}
+
+// checkKeyList checks ks like checkKey. The commands are sent in two batches,
+// the second one depending on the types of the keys returned by the first,
+// so with Options.Pipeline set ks take two round trips (plus the hash
+// fields) instead of several per key.
+func (e *Exporter) checkKeyList(r *redirector, c redis.Conn, addr string, f features, ks []dbKeyPair) {
+	m := e.keyMetricsOf(addr)
+	cmds := make([]keyCmds, len(ks))
+	var first cmdBatch
+	for i, k := range ks {
+		kc := &cmds[i]
+		kc.sel = first.add("SELECT", k.db)
+		kc.get = first.add("GET", k.key)
+		kc.typ = first.add("TYPE", k.key)
+		kc.pttl = first.add("PTTL", k.key)
+		if k.bitmap {
+			kc.bits = first.add("BITCOUNT", k.key)
+		}
+		if k.geo && f.geo {
+			kc.geo = first.add("ZCARD", k.key)
+		}
+		if k.radius != nil && f.geo {
+			kc.radius = first.add("GEORADIUS", k.key, k.radius.lon, k.radius.lat, k.radius.radius, k.radius.unit)
+		}
+		if k.fieldTTL != nil && f.hashFieldTTL {
+			kc.fieldTTL = first.add("HPTTL", hpttlArgs(k)...)
+		}
+		if f.memoryUsage {
+			kc.mem = first.add("MEMORY", e.memoryUsageArgs(k.key)...)
+		}
+	}
+	if err := first.run(r, c, e.opts.Pipeline); err != nil {
+		log.WithError(err).Debug("checking keys failed")
+		return
+	}
+
+	var second cmdBatch
+	for i, k := range ks {
+		kc := &cmds[i]
+		if kc.sel.err != nil {
+			continue
+		}
+		if kc.get.err == nil && kc.get.reply != nil {
+			if val, err := strconv.ParseFloat(fmt.Sprintf("%s", kc.get.reply), 64); err == nil {
+				m.keyValues.WithLabelValues(k.labels()...).Set(val)
+			}
+			if k.valueLabel {
+				m.keyValueInfo.set(k, sanitizeValueLabel(fmt.Sprintf("%s", kc.get.reply)))
+			}
+		}
+
+		typ, err := redis.String(kc.typ.reply, kc.typ.err)
+		kc.typeName = typ
+		if err == nil {
+			// the key may have been deleted or replaced by one of another type
+			for t, vec := range m.keyTypeSizes {
+				if t != typ {
+					vec.DeleteLabelValues(k.labels()...)
+				}
+			}
+		}
+		if err == nil && typ == "none" {
+			m.keySizes.WithLabelValues(k.labels()...).Set(0)
+		} else if err == nil {
+			second.add("SELECT", k.db)
+			if cmd, ok := sizeCommands[typ]; ok {
+				kc.size = second.add(cmd, k.key)
+			}
+			if typ == "string" && f.pfcount {
+				// only succeeds for HyperLogLog values
+				kc.hll = second.add("PFCOUNT", k.key)
+			}
+		}
+
+		if pttl, err := redis.Int64(kc.pttl.reply, kc.pttl.err); err == nil {
+			if ttl, ok := keyTTLSeconds(pttl); ok {
+				m.keyTTL.WithLabelValues(k.labels()...).Set(ttl)
+			} else {
+				// the key expired or was deleted
+				m.keyTTL.DeleteLabelValues(k.labels()...)
+			}
+		}
+		if kc.bits != nil {
+			if bits, err := redis.Int64(kc.bits.reply, kc.bits.err); err == nil {
+				m.keyBits.WithLabelValues(k.labels()...).Set(float64(bits))
+			}
+		}
+		if kc.geo != nil {
+			if members, err := redis.Int64(kc.geo.reply, kc.geo.err); err == nil {
+				m.keyGeo.WithLabelValues(k.labels()...).Set(float64(members))
+			}
+		}
+		if kc.radius != nil {
+			if members, err := redis.Values(kc.radius.reply, kc.radius.err); err == nil {
+				m.keyGeoRadius.WithLabelValues(k.labels()...).Set(float64(len(members)))
+			}
+		}
+		if kc.fieldTTL != nil {
+			if pttls, err := redis.Int64s(kc.fieldTTL.reply, kc.fieldTTL.err); err == nil {
+				e.setFieldTTLs(m, k, pttls)
+			}
+		}
+
+		var mem int64
+		err = errMemoryUsageUnsupported
+		if kc.mem != nil {
+			mem, err = redis.Int64(kc.mem.reply, kc.mem.err)
+		}
+		if err == nil {
+			m.keyMemory.WithLabelValues(k.labels()...).Set(float64(mem))
+		} else if err != redis.ErrNil && e.opts.KeyDebugObjectFallback {
+			// falls back to DEBUG OBJECT, see keyMemoryUsage
+			if _, err := c.Do("SELECT", k.db); err == nil {
+				if mem, ok := e.keyMemoryUsage(r, c, features{}, k.key); ok {
+					m.keyMemory.WithLabelValues(k.labels()...).Set(mem)
+				}
+			}
+		}
+	}
+	if err := second.run(r, c, e.opts.Pipeline); err != nil {
+		log.WithError(err).Debug("checking keys failed")
+		return
+	}
+
+	for i, k := range ks {
+		kc := &cmds[i]
+		if kc.size != nil {
+			if size, err := redis.Int64(kc.size.reply, kc.size.err); err == nil {
+				m.keySizes.WithLabelValues(k.labels()...).Set(float64(size))
+				m.keyTypeSizes[kc.typeName].WithLabelValues(k.labels()...).Set(float64(size))
+			}
+		}
+		if kc.hll != nil {
+			if card, err := redis.Int64(kc.hll.reply, kc.hll.err); err == nil {
+				m.keyHLL.WithLabelValues(k.labels()...).Set(float64(card))
+			}
+		}
+		if k.hashFields && kc.sel.err == nil {
+			if _, err := c.Do("SELECT", k.db); err == nil {
+				e.checkHashFields(r, c, m, k)
+			}
+		}
+		if k.memberPatterns != nil && kc.sel.err == nil && kc.typeName != "" && kc.typeName != "none" {
+			if _, err := c.Do("SELECT", k.db); err == nil {
+				e.checkMemberPatterns(r, c, m, k, kc.typeName)
+			}
+		}
+	}
+}
+
+var errMemoryUsageUnsupported = errors.New("MEMORY USAGE not supported")
+
+// keyMemoryUsage returns the memory usage of key via MEMORY USAGE, falling
+// back to the serializedlength of DEBUG OBJECT if enabled and MEMORY USAGE
+// failed or isn't supported.
+func (e *Exporter) keyMemoryUsage(r *redirector, c redis.Conn, f features, key string) (float64, bool) {
+	if f.memoryUsage {
+		mem, err := redis.Int64(r.do(c, "MEMORY", e.memoryUsageArgs(key)...))
+		if err == nil {
+			return float64(mem), true
+		}
+		if err == redis.ErrNil {
+			return 0, false
+		}
+	}
+	if !e.opts.KeyDebugObjectFallback {
+		return 0, false
+	}
+	obj, err := redis.String(r.do(c, "DEBUG", "OBJECT", key))
+	if err != nil {
+		return 0, false
+	}
+	return parseSerializedLength(obj)
+}
+
+// defaultGlobLimit is the number of keys checked per glob pattern if
+// Options.CheckKeysGlobLimit isn't set.
+const defaultGlobLimit = 1000
+
+// isGlob returns true if key is a pattern to be matched via SCAN, which
+// needs Options.CheckKeysGlob.
+func (e *Exporter) isGlob(key string) bool {
+	return e.opts.CheckKeysGlob && strings.ContainsAny(key, "*?[")
+}
+
+// checkGlobKey checks the keys of the node c is connected to matching the
+// pattern k.key, up to the configured limit.
+func (e *Exporter) checkGlobKey(c redis.Conn, addr string, f features, k dbKeyPair) {
+	entry := log.WithFields(log.Fields{"target": LabelAddr(addr), "db": k.db, "pattern": k.key})
+	if !f.scan {
+		entry.Debug("SCAN not supported, skipping pattern")
+		return
+	}
+	if _, err := c.Do("SELECT", k.db); err != nil {
+		entry.WithError(err).Debug("SELECT failed")
+		return
+	}
+
+	limit := e.opts.CheckKeysGlobLimit
+	if limit <= 0 {
+		limit = defaultGlobLimit
+	}
+	var keys []string
+	err := scanMatching(c, k.key, e.scanCount(), e.opts.ScanThrottle, func(key string) (bool, error) {
+		keys = append(keys, key)
+		return len(keys) <= limit, nil
+	})
+	if err != nil {
+		entry.WithError(err).Debug("SCAN failed")
+		return
+	}
+
+	truncated := 0.0
+	if len(keys) > limit {
+		entry.Warnf("pattern matches more than %d keys, only checking %d of them", limit, limit)
+		keys, truncated = keys[:limit], 1
+	}
+	e.keyMetricsOf(addr).keysTrunc.WithLabelValues(k.labels()...).Set(truncated)
+
+	matched := make([]dbKeyPair, len(keys))
+	for i, key := range keys {
+		matched[i] = k
+		matched[i].key = key
+	}
+	e.checkKeyList(nil, c, addr, f, matched)
+}
+
+// maxValueLabelLength is the maximum number of characters of a key value
+// exported as label.
+const maxValueLabelLength = 64
+
+// sanitizeValueLabel cuts value to maxValueLabelLength characters and
+// replaces invalid UTF-8 and non printable characters with '_'.
+func sanitizeValueLabel(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, value)
+	if runes := []rune(value); len(runes) > maxValueLabelLength {
+		value = string(runes[:maxValueLabelLength])
+	}
+	return value
+}
+
+// valueLabels exports the value of keys as label, dropping the series of
+// the previous value when it changes.
+type valueLabels struct {
+	mtx  sync.Mutex
+	vec  *prometheus.GaugeVec
+	last map[dbKeyPair]string
+}
+
+func (v *valueLabels) set(k dbKeyPair, value string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.last == nil {
+		v.last = map[dbKeyPair]string{}
+	}
+	id := dbKeyPair{db: k.db, key: k.key}
+	if old, ok := v.last[id]; ok && old != value {
+		v.vec.DeleteLabelValues(k.labels(old)...)
+	}
+	v.last[id] = value
+	v.vec.WithLabelValues(k.labels(value)...).Set(1)
+}
+
+func (v *valueLabels) reset() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.vec.Reset()
+	v.last = nil
+}
+
+// resetKeyMetrics drops the series of all checked keys, in all namespaces,
+// and the cached key checks, so the next scrape checks the keys again.
+func (e *Exporter) resetKeyMetrics() {
+	e.keyMetrics.reset()
+	e.nsMtx.Lock()
+	for _, m := range e.nsKeyMetrics {
+		m.reset()
+	}
+	e.nsMtx.Unlock()
+	e.keyCache.clear()
+}
+
+// maxHashFields bounds the number of fields of hashes exported via
+// key_hash_field_value.
+const maxHashFields = 1000
+
+// checkHashFields exports all numeric fields of the hash k to m.
+func (e *Exporter) checkHashFields(r *redirector, c redis.Conn, m *keyMetrics, k dbKeyPair) {
+	entry := log.WithField("key", k.key)
+	n, err := redis.Int64(r.do(c, "HLEN", k.key))
+	if err != nil {
+		entry.WithError(err).Debug("HLEN failed")
+		return
+	}
+	if n > maxHashFields {
+		entry.Debugf("hash has %d fields, more than %d, not exporting them", n, maxHashFields)
+		return
+	}
+	fields, err := redis.StringMap(r.do(c, "HGETALL", k.key))
+	if err != nil {
+		entry.WithError(err).Debug("HGETALL failed")
+		return
+	}
+	m.keyHashField.set(k, numericFields(fields))
+}
+
+// numericFields returns the fields of a hash whose value is numeric.
+func numericFields(fields map[string]string) map[string]float64 {
+	res := map[string]float64{}
+	for field, value := range fields {
+		if val, err := strconv.ParseFloat(value, 64); err == nil {
+			res[field] = val
+		}
+	}
+	return res
+}
+
+// hashFieldValues exports the numeric fields of hashes, dropping the series
+// of fields that went away.
+type hashFieldValues struct {
+	mtx  sync.Mutex
+	vec  *prometheus.GaugeVec
+	last map[dbKeyPair]map[string]float64
+}
+
+func (h *hashFieldValues) set(k dbKeyPair, fields map[string]float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.last == nil {
+		h.last = map[dbKeyPair]map[string]float64{}
+	}
+	id := dbKeyPair{db: k.db, key: k.key}
+	for field := range h.last[id] {
+		if _, ok := fields[field]; !ok {
+			h.vec.DeleteLabelValues(k.labels(field)...)
+		}
+	}
+	h.last[id] = fields
+	for field, val := range fields {
+		h.vec.WithLabelValues(k.labels(field)...).Set(val)
+	}
+}
+
+func (h *hashFieldValues) reset() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.vec.Reset()
+	h.last = nil
+}
+
+// keyTTLSeconds converts a PTTL reply to seconds, keeping -1 (no expiry).
+// Missing keys (-2) have no TTL, their key_ttl_seconds series is dropped.
+func keyTTLSeconds(pttl int64) (float64, bool) {
+	switch {
+	case pttl == -1:
+		return -1, true
+	case pttl < 0:
+		return 0, false
+	}
+	return float64(pttl) / 1000, true
+}
+
+// memoryUsageArgs returns the arguments of MEMORY for the memory usage of key.
+func (e *Exporter) memoryUsageArgs(key string) []interface{} {
+	switch {
+	case e.opts.KeyMemorySamples > 0:
+		return []interface{}{"USAGE", key, "SAMPLES", e.opts.KeyMemorySamples}
+	case e.opts.KeyMemorySamples < 0:
+		return []interface{}{"USAGE", key, "SAMPLES", 0}
+	}
+	return []interface{}{"USAGE", key}
+}
+
+// parseSerializedLength returns the serializedlength field of a DEBUG OBJECT
+// reply, e.g. Value at:0x7f5d0c41a0c0 refcount:1 encoding:raw serializedlength:6 lru:1 lru_seconds_idle:10
+func parseSerializedLength(obj string) (float64, bool) {
+	for _, field := range strings.Fields(obj) {
+		if strings.HasPrefix(field, "serializedlength:") {
+			size, err := strconv.ParseFloat(strings.TrimPrefix(field, "serializedlength:"), 64)
+			return size, err == nil
+		}
+	}
+	return 0, false
+}
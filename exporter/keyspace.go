@@ -0,0 +1,204 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// defaultKeyspaceSampleLimit is the number of keys sampled per db and scrape
+// if Options.KeyspaceSampleLimit isn't set.
+const defaultKeyspaceSampleLimit = 10000
+
+// defaultKeySizeBuckets are the buckets of keyspace_key_memory_bytes if
+// Options.KeySizeBuckets isn't set, 64B to 16MiB.
+var defaultKeySizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// durationBuckets are the buckets of keyspace_key_idle_seconds and of the
+// TTLs of AnalyzeRDB, 1 minute to 30 days.
+var durationBuckets = []float64{60, 300, 900, 3600, 4 * 3600, 24 * 3600, 7 * 24 * 3600, 30 * 24 * 3600}
+
+// parseDBs parses a comma separated list of dbs, e.g. db0,db3 or 0,3.
+func parseDBs(s string) ([]string, error) {
+	var dbs []string
+	for _, db := range strings.Split(s, ",") {
+		db = strings.TrimPrefix(strings.TrimSpace(db), "db")
+		if db == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid db %q", db)
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// ValidateKeyspaceDBs returns an error if s isn't a valid --keyspace-sample
+// value.
+func ValidateKeyspaceDBs(s string) error {
+	_, err := parseDBs(s)
+	return err
+}
+
+// ParseBuckets parses a comma separated list of histogram buckets, which
+// must be increasing.
+func ParseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, b := range strings.Split(s, ",") {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(b, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q", b)
+		}
+		if len(buckets) > 0 && v <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be increasing, %q isn't", b)
+		}
+		buckets = append(buckets, v)
+	}
+	return buckets, nil
+}
+
+// sampleHistogram is the distribution of the values sampled during a single
+// scrape, sent as the _bucket, _sum and _count series of a histogram.
+type sampleHistogram struct {
+	buckets []float64
+	counts  []float64
+	sum     float64
+	count   float64
+}
+
+func newSampleHistogram(buckets []float64) *sampleHistogram {
+	return &sampleHistogram{buckets: buckets, counts: make([]float64, len(buckets))}
+}
+
+func (h *sampleHistogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+// send sends the cumulative bucket counts, the sum and the count of h as
+// the histogram name of addr and db.
+func (h *sampleHistogram) send(scrapes chan<- scrapeResult, name, addr, db string) {
+	cumulative := 0.0
+	for i, b := range h.buckets {
+		cumulative += h.counts[i]
+		le := strconv.FormatFloat(b, 'g', -1, 64)
+		scrapes <- scrapeResult{Name: name + "_bucket", Addr: addr, DB: db, Labels: map[string]string{"le": le}, Value: cumulative}
+	}
+	scrapes <- scrapeResult{Name: name + "_sum", Addr: addr, DB: db, Value: h.sum}
+	scrapes <- scrapeResult{Name: name + "_count", Addr: addr, DB: db, Value: h.count}
+}
+
+// biggestKeys keeps the n keys with the highest memory usage, biggest first.
+type biggestKeys struct {
+	n    int
+	keys []KeyInfo
+}
+
+func (b *biggestKeys) add(info KeyInfo) {
+	i := sort.Search(len(b.keys), func(i int) bool { return !byMemory(b.keys).lessThan(b.keys[i], info) })
+	if i >= b.n {
+		return
+	}
+	b.keys = append(b.keys, KeyInfo{})
+	copy(b.keys[i+1:], b.keys[i:])
+	b.keys[i] = info
+	if len(b.keys) > b.n {
+		b.keys = b.keys[:b.n]
+	}
+}
+
+// keySizeBuckets returns the buckets of keyspace_key_memory_bytes.
+func (e *Exporter) keySizeBuckets() []float64 {
+	if len(e.opts.KeySizeBuckets) > 0 {
+		return e.opts.KeySizeBuckets
+	}
+	return defaultKeySizeBuckets
+}
+
+// sampleKeyspace SCANs the configured dbs, looking at no more than the
+// sample limit of keys each, and sends the distribution of the memory usage
+// of the sampled keys and the biggest of them, and their idle time if
+// Options.KeyspaceIdleTime is set.
+func (e *Exporter) sampleKeyspace(c redis.Conn, addr string, f features, scrapes chan<- scrapeResult) {
+	if !f.scan {
+		log.WithField("target", LabelAddr(addr)).Debug("SCAN not supported, not sampling the keyspace")
+		return
+	}
+	limit := e.opts.KeyspaceSampleLimit
+	if limit <= 0 {
+		limit = defaultKeyspaceSampleLimit
+	}
+	for _, db := range e.keyspaceDBs {
+		entry := log.WithFields(log.Fields{"target": LabelAddr(addr), "db": db})
+		if _, err := c.Do("SELECT", db); err != nil {
+			entry.WithError(err).Debug("SELECT failed")
+			continue
+		}
+
+		sizes := newSampleHistogram(e.keySizeBuckets())
+		biggest := biggestKeys{n: e.opts.KeyspaceTopN}
+		idle := newSampleHistogram(durationBuckets)
+		// OBJECT IDLETIME fails for all keys with an LFU maxmemory-policy
+		idleTracked := e.opts.KeyspaceIdleTime
+		sampled := 0
+		sample := func(key string) {
+			sampled++
+			if mem, ok := e.keyMemoryUsage(nil, c, f, key); ok {
+				sizes.observe(mem)
+				biggest.add(KeyInfo{Key: key, MemoryBytes: int64(mem)})
+			}
+			if idleTracked {
+				if secs, err := redis.Int64(c.Do("OBJECT", "IDLETIME", key)); err == nil {
+					idle.observe(float64(secs))
+				} else if _, ok := err.(redis.Error); ok {
+					entry.WithError(err).Debug("OBJECT IDLETIME failed")
+					idleTracked = false
+				}
+			}
+		}
+		var err error
+		if e.opts.ScanChunk > 0 {
+			// sample the next keys instead of the first ones again
+			st := e.scans.get(addr, "keyspace-sample", db)
+			st.cursor, err = scanChunk(c, "*", e.scanCount(), e.opts.ScanThrottle, st.cursor, limit, sample)
+		} else {
+			err = scanMatching(c, "*", e.scanCount(), e.opts.ScanThrottle, func(key string) (bool, error) {
+				if sampled >= limit {
+					return false, nil
+				}
+				sample(key)
+				return true, nil
+			})
+		}
+		if err != nil {
+			entry.WithError(err).Debug("SCAN failed")
+			continue
+		}
+
+		sizes.send(scrapes, "keyspace_key_memory_bytes", addr, "db"+db)
+		scrapes <- scrapeResult{Name: "keyspace_sampled_keys", Addr: addr, DB: "db" + db, Value: float64(sampled)}
+		if idleTracked {
+			idle.send(scrapes, "keyspace_key_idle_seconds", addr, "db"+db)
+		}
+		for _, k := range biggest.keys {
+			typ, err := redis.String(c.Do("TYPE", k.Key))
+			if err != nil || typ == "none" {
+				// deleted since it was sampled
+				continue
+			}
+			labels := map[string]string{"key": k.Key, "type": typ}
+			scrapes <- scrapeResult{Name: "biggest_key_bytes", Addr: addr, DB: "db" + db, Labels: labels, Value: float64(k.MemoryBytes)}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// sanitizeLabelValue makes s a valid label value, prometheus rejects values
+// that aren't valid UTF-8 (binary keys). The invalid bytes are escaped as
+// \xNN, valid values are kept as they are.
+func sanitizeLabelValue(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// sanitizeMetricName replaces the characters of name that aren't allowed in
+// metric names, e.g. the dots of module fields, with '_'.
+func sanitizeMetricName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// labels returns the db and key label values of k followed by extra, all
+// sanitized.
+func (k dbKeyPair) labels(extra ...string) []string {
+	values := append([]string{"db" + k.db, sanitizeLabelValue(k.key)}, extra...)
+	for i := 2; i < len(values); i++ {
+		values[i] = sanitizeLabelValue(values[i])
+	}
+	return values
+}
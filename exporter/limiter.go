@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+)
+
+// ScrapeLimiter bounds the number of redis hosts that are scraped at the same time.
+type ScrapeLimiter struct {
+	sem chan struct{}
+}
+
+// NewScrapeLimiter returns a limiter that allows up to max concurrent scrapes,
+// max <= 0 means no limit.
+func NewScrapeLimiter(max int) *ScrapeLimiter {
+	l := &ScrapeLimiter{}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+func (l *ScrapeLimiter) acquire() {
+	if l == nil || l.sem == nil {
+		return
+	}
+	l.sem <- struct{}{}
+}
+
+func (l *ScrapeLimiter) release() {
+	if l == nil || l.sem == nil {
+		return
+	}
+	<-l.sem
+}
+
+// ScanThrottle paces the SCANs of the keyspace (key checks with patterns,
+// key groups, keyspace sampling, ScanKeys and AnalyzeKeys) to a number of
+// keys per second, it can be shared by several exporters to throttle all
+// their SCANs together.
+type ScanThrottle struct {
+	interval time.Duration
+
+	mtx  sync.Mutex
+	next time.Time
+}
+
+// NewScanThrottle returns a throttle that allows keysPerSecond keys to be
+// scanned, keysPerSecond <= 0 means no limit.
+func NewScanThrottle(keysPerSecond float64) *ScanThrottle {
+	t := &ScanThrottle{}
+	if keysPerSecond > 0 {
+		t.interval = time.Duration(float64(time.Second) / keysPerSecond)
+	}
+	return t
+}
+
+// wait blocks until the n keys returned by a SCAN call may be processed.
+func (t *ScanThrottle) wait(n int) {
+	if t == nil || t.interval == 0 || n <= 0 {
+		return
+	}
+	t.mtx.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(time.Duration(n) * t.interval)
+	t.mtx.Unlock()
+	time.Sleep(start.Sub(now))
+}
@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// memberPatterns are the patterns the members of a set or sorted set are
+// counted for.
+type memberPatterns struct {
+	patterns []string
+}
+
+// merge returns the patterns of m and other.
+func (m *memberPatterns) merge(other *memberPatterns) *memberPatterns {
+	if m == nil {
+		return other
+	}
+	return &memberPatterns{patterns: appendMissing(append([]string{}, m.patterns...), other.patterns...)}
+}
+
+// appendMissing appends the items not in list yet to list.
+func appendMissing(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, have := range list {
+			found = found || have == item
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseMemberPatternKey parses a single check-member-pattern-keys entry of
+// the form [db<n>=]<key>@<pattern>, e.g. db0=jobs@failed:*.
+func parseMemberPatternKey(k string) (dbKeyPair, error) {
+	i := strings.Index(k, "@")
+	if i == -1 {
+		return dbKeyPair{}, fmt.Errorf("missing pattern in %q, expected <key>@<pattern>", k)
+	}
+	pattern := strings.TrimSpace(k[i+1:])
+	if pattern == "" {
+		return dbKeyPair{}, fmt.Errorf("empty pattern in %q", k)
+	}
+	pair, err := parseCheckKey(k[:i])
+	if err != nil {
+		return dbKeyPair{}, err
+	}
+	pair.memberPatterns = &memberPatterns{patterns: []string{pattern}}
+	return pair, nil
+}
+
+// ValidateMemberPatternKeys returns an error describing the first malformed
+// entry of a comma separated check-member-pattern-keys list.
+func ValidateMemberPatternKeys(checkKeys string) error {
+	for idx, k := range strings.Split(checkKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		if _, err := parseMemberPatternKey(k); err != nil {
+			return fmt.Errorf("entry %d: %s", idx, err)
+		}
+	}
+	return nil
+}
+
+// memberScanCommands maps the collection types members are counted for to
+// the command scanning them and the number of reply elements per member.
+var memberScanCommands = map[string]struct {
+	cmd     string
+	perItem int
+}{
+	"set":  {"SSCAN", 1},
+	"zset": {"ZSCAN", 2},
+}
+
+// checkMemberPatterns exports the number of members of the set or sorted set
+// k of type typ matching each of its patterns, found via SSCAN or ZSCAN, to m.
+func (e *Exporter) checkMemberPatterns(r *redirector, c redis.Conn, m *keyMetrics, k dbKeyPair, typ string) {
+	scan, ok := memberScanCommands[typ]
+	if !ok {
+		log.WithField("key", k.key).Debugf("can't count the members of a %s", typ)
+		return
+	}
+	for _, pattern := range k.memberPatterns.patterns {
+		n, err := countMembers(r, c, scan.cmd, k.key, pattern, e.scanCount(), e.opts.ScanThrottle)
+		if err != nil {
+			log.WithField("key", k.key).WithError(err).Debugf("%s failed", scan.cmd)
+			continue
+		}
+		m.keyMembersMatching.WithLabelValues(k.labels(pattern)...).Set(float64(n / scan.perItem))
+	}
+}
+
+// countMembers returns the number of reply elements of all calls of cmd
+// (SSCAN or ZSCAN) iterating the members of key matching pattern.
+func countMembers(r *redirector, c redis.Conn, cmd, key, pattern string, count int, throttle *ScanThrottle) (int, error) {
+	cursor, n := 0, 0
+	for {
+		values, err := redis.Values(r.do(c, cmd, key, cursor, "MATCH", pattern, "COUNT", count))
+		if err != nil {
+			return 0, err
+		}
+		if len(values) != 2 {
+			return 0, errUnexpectedScanReply
+		}
+		if cursor, err = redis.Int(values[0], nil); err != nil {
+			return 0, err
+		}
+		items, err := redis.Values(values[1], nil)
+		if err != nil {
+			return 0, err
+		}
+		n += len(items)
+		throttle.wait(len(items))
+		if cursor == 0 {
+			return n, nil
+		}
+	}
+}
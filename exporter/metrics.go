@@ -0,0 +1,266 @@
+package exporter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricType is the prometheus type a metric is exposed as.
+type metricType int
+
+const (
+	gaugeMetric metricType = iota
+	counterMetric
+	// histogramMetric is sent as the _bucket (with an le label), _sum and
+	// _count series of the histogram
+	histogramMetric
+)
+
+// metricDesc describes a metric sent as scrapeResult: its name without
+// namespace, type, help and the unit of its value if it has one.
+type metricDesc struct {
+	name string
+	typ  metricType
+	help string
+	unit string
+}
+
+// helpText returns the help of d including its unit.
+func (d metricDesc) helpText() string {
+	if d.unit == "" {
+		return d.help
+	}
+	return d.help + ", in " + d.unit
+}
+
+// infoFields maps the INFO fields exported under a metric of their own to
+// the metric. The commandstats, keyspace, latencystats and errorstats
+// sections and cluster_ fields are parsed separately, cluster_ fields not
+// listed here keep their name.
+var infoFields = map[string]metricDesc{
+	// # Server
+	"uptime_in_seconds": {"uptime_in_seconds", gaugeMetric, "Time since the redis server started", "seconds"},
+
+	// # Clients
+	"connected_clients": {"connected_clients", gaugeMetric, "Number of client connections, excluding replicas", ""},
+	"blocked_clients":   {"blocked_clients", gaugeMetric, "Number of clients blocked in BLPOP, BRPOP, BRPOPLPUSH or similar", ""},
+
+	// # Memory
+	"used_memory":             {"memory_used_bytes", gaugeMetric, "Memory allocated by redis", "bytes"},
+	"used_memory_rss":         {"memory_used_rss_bytes", gaugeMetric, "Memory allocated by redis as seen by the operating system", "bytes"},
+	"used_memory_peak":        {"memory_used_peak_bytes", gaugeMetric, "Peak memory allocated by redis", "bytes"},
+	"used_memory_lua":         {"memory_used_lua_bytes", gaugeMetric, "Memory used by the Lua engine", "bytes"},
+	"max_memory":              {"memory_max_bytes", gaugeMetric, "Configured maxmemory", "bytes"},
+	"mem_fragmentation_ratio": {"memory_fragmentation_ratio", gaugeMetric, "Ratio of memory_used_rss_bytes to memory_used_bytes", ""},
+
+	// # Persistence
+	"rdb_changes_since_last_save":  {"rdb_changes_since_last_save", gaugeMetric, "Number of changes since the last RDB dump", ""},
+	"rdb_last_bgsave_time_sec":     {"rdb_last_bgsave_duration_sec", gaugeMetric, "Duration of the last RDB save", "seconds"},
+	"rdb_current_bgsave_time_sec":  {"rdb_current_bgsave_duration_sec", gaugeMetric, "Duration of the running RDB save, -1 if none is running", "seconds"},
+	"aof_enabled":                  {"aof_enabled", gaugeMetric, "Whether AOF logging is enabled", ""},
+	"aof_rewrite_in_progress":      {"aof_rewrite_in_progress", gaugeMetric, "Whether an AOF rewrite is running", ""},
+	"aof_rewrite_scheduled":        {"aof_rewrite_scheduled", gaugeMetric, "Whether an AOF rewrite is scheduled after the running RDB save", ""},
+	"aof_last_rewrite_time_sec":    {"aof_last_rewrite_duration_sec", gaugeMetric, "Duration of the last AOF rewrite", "seconds"},
+	"aof_current_rewrite_time_sec": {"aof_current_rewrite_duration_sec", gaugeMetric, "Duration of the running AOF rewrite, -1 if none is running", "seconds"},
+
+	// # Stats
+	"total_connections_received": {"connections_received_total", counterMetric, "Total number of connections accepted", ""},
+	"total_commands_processed":   {"commands_processed_total", counterMetric, "Total number of commands processed", ""},
+	"total_net_input_bytes":      {"net_input_bytes_total", counterMetric, "Total network input", "bytes"},
+	"total_net_output_bytes":     {"net_output_bytes_total", counterMetric, "Total network output", "bytes"},
+	"rejected_connections":       {"rejected_connections_total", counterMetric, "Total number of connections rejected because of maxclients", ""},
+	"expired_keys":               {"expired_keys_total", counterMetric, "Total number of expired keys", ""},
+	"evicted_keys":               {"evicted_keys_total", counterMetric, "Total number of keys evicted because of maxmemory", ""},
+	"keyspace_hits":              {"keyspace_hits_total", counterMetric, "Total number of successful key lookups", ""},
+	"keyspace_misses":            {"keyspace_misses_total", counterMetric, "Total number of failed key lookups", ""},
+	"pubsub_channels":            {"pubsub_channels", gaugeMetric, "Number of pub/sub channels with subscribers", ""},
+	"pubsub_patterns":            {"pubsub_patterns", gaugeMetric, "Number of pub/sub pattern subscriptions", ""},
+
+	// # Replication
+	"loading":           {"loading_dump_file", gaugeMetric, "Whether a dump file is being loaded", ""},
+	"connected_slaves":  {"connected_slaves", gaugeMetric, "Number of connected replicas", ""},
+	"repl_backlog_size": {"replication_backlog_bytes", gaugeMetric, "Size of the replication backlog", "bytes"},
+
+	// # CPU
+	"used_cpu_sys":           {"used_cpu_sys", gaugeMetric, "System CPU consumed by the redis server", "seconds"},
+	"used_cpu_user":          {"used_cpu_user", gaugeMetric, "User CPU consumed by the redis server", "seconds"},
+	"used_cpu_sys_children":  {"used_cpu_sys_children", gaugeMetric, "System CPU consumed by the background processes", "seconds"},
+	"used_cpu_user_children": {"used_cpu_user_children", gaugeMetric, "User CPU consumed by the background processes", "seconds"},
+
+	// # Cluster
+	"cluster_stats_messages_sent":     {"cluster_messages_sent_total", counterMetric, "Total number of messages sent via the cluster bus", ""},
+	"cluster_stats_messages_received": {"cluster_messages_received_total", counterMetric, "Total number of messages received via the cluster bus", ""},
+}
+
+// metricDescs describes the metrics by name, the ones of infoFields and
+// those derived from other INFO sections and commands.
+var metricDescs = map[string]metricDesc{
+	"up":                                      {"up", gaugeMetric, "Whether the redis node could be scraped", ""},
+	"replication_is_master":                   {"replication_is_master", gaugeMetric, "Whether the node is a master", ""},
+	"db_keys":                                 {"db_keys", gaugeMetric, "Total number of keys by DB", ""},
+	"db_keys_expiring":                        {"db_keys_expiring", gaugeMetric, "Total number of expiring keys by DB", ""},
+	"db_avg_ttl_seconds":                      {"db_avg_ttl_seconds", gaugeMetric, "Avg TTL in seconds", ""},
+	"cluster_db_keys":                         {"cluster_db_keys", gaugeMetric, "Total number of keys by DB summed up across all scraped cluster masters", ""},
+	"cluster_db_keys_expiring":                {"cluster_db_keys_expiring", gaugeMetric, "Total number of expiring keys by DB summed up across all scraped cluster masters", ""},
+	"command_call_duration_seconds_count":     {"command_call_duration_seconds_count", gaugeMetric, "Total number of calls per command", ""},
+	"command_call_duration_seconds_sum":       {"command_call_duration_seconds_sum", gaugeMetric, "Total amount of time in seconds spent per command", ""},
+	"commands_rejected_calls_total":           {"commands_rejected_calls_total", counterMetric, "Total number of calls rejected before execution per command", ""},
+	"commands_failed_calls_total":             {"commands_failed_calls_total", counterMetric, "Total number of calls failed during execution per command", ""},
+	"command_latency_seconds":                 {"command_latency_seconds", gaugeMetric, "Latency percentiles per command", "seconds"},
+	"errors_total":                            {"errors_total", counterMetric, "Total number of errors returned to clients by error prefix", ""},
+	"cluster_messages_sent_by_type_total":     {"cluster_messages_sent_by_type_total", counterMetric, "Total number of messages sent via the cluster bus by message type", ""},
+	"cluster_messages_received_by_type_total": {"cluster_messages_received_by_type_total", counterMetric, "Total number of messages received via the cluster bus by message type", ""},
+	"latency_monitoring_enabled":              {"latency_monitoring_enabled", gaugeMetric, "Whether latency-monitor-threshold is set, enabling the latency monitor", ""},
+	"config_notify_keyspace_events_info":      {"config_notify_keyspace_events_info", gaugeMetric, "The notify-keyspace-events flags", ""},
+	"config_save_points":                      {"config_save_points", gaugeMetric, "Number of RDB save points", ""},
+	"config_save_seconds":                     {"config_save_seconds", gaugeMetric, "Seconds after which the RDB save point triggers", ""},
+	"config_save_changes":                     {"config_save_changes", gaugeMetric, "Changes after which the RDB save point triggers", ""},
+	"server_mode_info":                        {"server_mode_info", gaugeMetric, "The operating mode of the node", ""},
+	"ping_duration_seconds":                   {"ping_duration_seconds", gaugeMetric, "Round trip time of a PING to the node in minimal mode", "seconds"},
+	"keyspace_key_memory_bytes":               {"keyspace_key_memory_bytes", histogramMetric, "Memory usage of the keys sampled by SCANning the db", "bytes"},
+	"keyspace_sampled_keys":                   {"keyspace_sampled_keys", gaugeMetric, "Number of keys sampled by SCANning the db", ""},
+	"keyspace_key_idle_seconds":               {"keyspace_key_idle_seconds", histogramMetric, "Time since the keys sampled by SCANning the db were last accessed", "seconds"},
+	"biggest_key_bytes":                       {"biggest_key_bytes", gaugeMetric, "Memory usage of the biggest keys sampled by SCANning the db", "bytes"},
+	"memory_used_percent":                     {"memory_used_percent", gaugeMetric, "used_memory as percentage of maxmemory, absent without maxmemory", ""},
+}
+
+func init() {
+	for _, d := range infoFields {
+		metricDescs[d.name] = d
+	}
+}
+
+// describeMetric returns the description of the metric name, metrics not
+// described are gauges without help.
+func describeMetric(name string) metricDesc {
+	if d, ok := metricDescs[name]; ok {
+		return d
+	}
+	if strings.HasPrefix(name, discoveredFieldPrefix) {
+		return metricDesc{name: name, typ: gaugeMetric, help: "INFO field " + strings.TrimPrefix(name, discoveredFieldPrefix) + " (discovered, not known to the exporter)"}
+	}
+	return metricDesc{name: name, typ: gaugeMetric}
+}
+
+// collectAsCounters sends the metrics of vec, a gauge vector of the counter
+// name, as counters.
+func collectAsCounters(vec *prometheus.GaugeVec, fqName, help string, ch chan<- prometheus.Metric) {
+	gauges := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(gauges)
+		close(gauges)
+	}()
+	for g := range gauges {
+		m := &dto.Metric{}
+		if err := g.Write(m); err != nil {
+			continue
+		}
+		var names, values []string
+		pairs := m.GetLabel()
+		sort.Sort(byLabelName(pairs))
+		for _, p := range pairs {
+			names = append(names, p.GetName())
+			values = append(values, p.GetValue())
+		}
+		desc := prometheus.NewDesc(fqName, help, names, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, m.GetGauge().GetValue(), values...)
+	}
+}
+
+// histogramOf returns the histogram the series name is part of.
+func histogramOf(name string) (string, bool) {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base := strings.TrimSuffix(name, suffix)
+		if base != name && describeMetric(base).typ == histogramMetric {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// collectAsHistograms sends the metrics of buckets, sums and counts, the
+// gauge vectors of the series of the histogram name, as histograms.
+func collectAsHistograms(buckets, sums, counts *prometheus.GaugeVec, fqName, help string, ch chan<- prometheus.Metric) {
+	if sums == nil || counts == nil {
+		return
+	}
+	type histogram struct {
+		names, values []string
+		buckets       map[float64]uint64
+	}
+	histograms := map[string]*histogram{}
+	gauges := make(chan prometheus.Metric)
+	go func() {
+		buckets.Collect(gauges)
+		close(gauges)
+	}()
+	for g := range gauges {
+		m := &dto.Metric{}
+		if err := g.Write(m); err != nil {
+			continue
+		}
+		var names, values []string
+		le := ""
+		pairs := m.GetLabel()
+		sort.Sort(byLabelName(pairs))
+		for _, p := range pairs {
+			if p.GetName() == "le" {
+				le = p.GetValue()
+				continue
+			}
+			names = append(names, p.GetName())
+			values = append(values, p.GetValue())
+		}
+		bound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			continue
+		}
+		key := strings.Join(values, "\x00")
+		h, ok := histograms[key]
+		if !ok {
+			h = &histogram{names: names, values: values, buckets: map[float64]uint64{}}
+			histograms[key] = h
+		}
+		h.buckets[bound] = uint64(m.GetGauge().GetValue())
+	}
+
+	for _, h := range histograms {
+		labels := prometheus.Labels{}
+		for i, name := range h.names {
+			labels[name] = h.values[i]
+		}
+		sum, err := gaugeValue(sums, labels)
+		if err != nil {
+			continue
+		}
+		count, err := gaugeValue(counts, labels)
+		if err != nil {
+			continue
+		}
+		desc := prometheus.NewDesc(fqName, help, h.names, nil)
+		ch <- prometheus.MustNewConstHistogram(desc, uint64(count), sum, h.buckets, h.values...)
+	}
+}
+
+// gaugeValue returns the value of the gauge of vec with labels.
+func gaugeValue(vec *prometheus.GaugeVec, labels prometheus.Labels) (float64, error) {
+	g, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return 0, err
+	}
+	m := &dto.Metric{}
+	if err := g.Write(m); err != nil {
+		return 0, err
+	}
+	return m.GetGauge().GetValue(), nil
+}
+
+type byLabelName []*dto.LabelPair
+
+func (s byLabelName) Len() int           { return len(s) }
+func (s byLabelName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLabelName) Less(i, j int) bool { return s[i].GetName() < s[j].GetName() }
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// maxMonitorLines bounds the commands read per MONITOR window, so a
+	// very busy node can't keep the exporter busy parsing.
+	maxMonitorLines = 100000
+	// maxMonitorPrefixes bounds the number of key prefixes exported, the
+	// rest is counted as prefix="other".
+	maxMonitorPrefixes = 100
+)
+
+// parseMonitorLine returns the command and key (if any) of a line sent by
+// MONITOR, e.g. 1339518083.107412 [0 127.0.0.1:60866] "set" "user:1" "x"
+func parseMonitorLine(line string) (string, string, bool) {
+	i := strings.Index(line, "] ")
+	if i == -1 {
+		return "", "", false
+	}
+	args := parseQuotedArgs(line[i+2:], 2)
+	if len(args) == 0 {
+		return "", "", false
+	}
+	key := ""
+	if len(args) > 1 {
+		key = args[1]
+	}
+	return strings.ToLower(args[0]), key, true
+}
+
+// parseQuotedArgs returns up to n double quoted, space separated arguments
+// of s. Escape sequences are kept as they are.
+func parseQuotedArgs(s string, n int) []string {
+	var args []string
+	for len(args) < n {
+		start := strings.Index(s, `"`)
+		if start == -1 {
+			break
+		}
+		end := -1
+		for i := start + 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			break
+		}
+		args = append(args, s[start+1:end])
+		s = s[end+1:]
+	}
+	return args
+}
+
+// keyPrefix returns the part of key before the first ':', "none" if there is
+// no prefix.
+func keyPrefix(key string) string {
+	if i := strings.Index(key, ":"); i > 0 {
+		return key[:i]
+	}
+	return "none"
+}
+
+// monitorSample counts the commands and key prefixes seen during a MONITOR
+// window.
+type monitorSample struct {
+	cmds     map[string]float64
+	prefixes map[string]float64
+}
+
+func newMonitorSample() *monitorSample {
+	return &monitorSample{cmds: map[string]float64{}, prefixes: map[string]float64{}}
+}
+
+func (s *monitorSample) add(line string) {
+	cmd, key, ok := parseMonitorLine(line)
+	if !ok {
+		return
+	}
+	s.cmds[cmd]++
+	if key == "" {
+		return
+	}
+	prefix := keyPrefix(key)
+	if _, ok := s.prefixes[prefix]; !ok && len(s.prefixes) >= maxMonitorPrefixes {
+		prefix = "other"
+	}
+	s.prefixes[prefix]++
+}
+
+// results returns the observed rates per second over the window d.
+func (s *monitorSample) results(addr string, d time.Duration) []scrapeResult {
+	res := []scrapeResult{{Name: "monitor_sample_seconds", Addr: addr, Value: d.Seconds()}}
+	if d <= 0 {
+		return res
+	}
+	for cmd, n := range s.cmds {
+		res = append(res, scrapeResult{Name: "monitor_commands_per_second", Addr: addr, Cmd: cmd, Value: n / d.Seconds()})
+	}
+	for prefix, n := range s.prefixes {
+		res = append(res, scrapeResult{Name: "monitor_key_prefix_commands_per_second", Addr: addr, Labels: map[string]string{"prefix": prefix}, Value: n / d.Seconds()})
+	}
+	return res
+}
+
+// sampleMonitor attaches MONITOR to the node addr for the configured window
+// on a connection of its own and sends the observed command mix. MONITOR is
+// expensive for redis, the window should be short.
+func (e *Exporter) sampleMonitor(idx int, addr string, scrapes chan<- scrapeResult) {
+	entry := log.WithField("target", LabelAddr(addr))
+	c, err := e.connectToRedis(idx, addr)
+	if err != nil {
+		entry.WithError(err).Debug("MONITOR connection failed")
+		return
+	}
+	// a connection in MONITOR mode can't be used for anything else
+	defer c.Close()
+
+	if _, err := c.Do("MONITOR"); err != nil {
+		entry.WithError(err).Debug("MONITOR failed")
+		return
+	}
+
+	sample := newMonitorSample()
+	start := time.Now()
+	deadline := start.Add(e.opts.MonitorSampleDuration)
+	for lines := 0; lines < maxMonitorLines; lines++ {
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+		line, err := redis.String(redis.ReceiveWithTimeout(c, remaining))
+		if err != nil {
+			// the read timing out ends the window
+			break
+		}
+		sample.add(line)
+	}
+	for _, scr := range sample.results(addr, time.Since(start)) {
+		scrapes <- scr
+	}
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var namespaceRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseNamespaceMap parses a comma separated list of <addr>=<namespace>, the
+// format of --namespace-map. An addr may contain "=" itself, e.g. in query
+// parameters, the namespace follows the last one.
+func ParseNamespaceMap(s string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idx := strings.LastIndex(entry, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid namespace mapping %q, expected <addr>=<namespace>", entry)
+		}
+		addr, namespace := entry[:idx], entry[idx+1:]
+		if err := ValidateNamespace(namespace); err != nil {
+			return nil, err
+		}
+		res[addr] = namespace
+	}
+	return res, nil
+}
+
+// ValidateNamespace returns an error if namespace can't be used as prefix of
+// metric names.
+func ValidateNamespace(namespace string) error {
+	if !namespaceRE.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q, must match %s", namespace, namespaceRE)
+	}
+	return nil
+}
+
+// withNamespace returns the results of the target addr under its namespace
+// of Options.NamespaceMap, if it has one.
+func (e *Exporter) withNamespace(addr string, results []scrapeResult) []scrapeResult {
+	namespace, ok := e.opts.NamespaceMap[addr]
+	if !ok || namespace == e.namespace {
+		return results
+	}
+	res := make([]scrapeResult, len(results))
+	for idx, scr := range results {
+		scr.Namespace = namespace
+		res[idx] = scr
+	}
+	return res
+}
+
+// namespaceOf returns the namespace the metrics of the target addr are
+// exported under.
+func (e *Exporter) namespaceOf(addr string) string {
+	if namespace, ok := e.opts.NamespaceMap[addr]; ok {
+		return namespace
+	}
+	return e.namespace
+}
+
+// keyMetricsOf returns the key check metrics of the target addr, creating
+// the ones of its namespace on first use.
+func (e *Exporter) keyMetricsOf(addr string) *keyMetrics {
+	namespace := e.namespaceOf(addr)
+	if namespace == e.namespace {
+		return e.keyMetrics
+	}
+	e.nsMtx.Lock()
+	defer e.nsMtx.Unlock()
+	m, ok := e.nsKeyMetrics[namespace]
+	if !ok {
+		m = newKeyMetrics(namespace, e.opts)
+		e.nsKeyMetrics[namespace] = m
+	}
+	return m
+}
+
+// telemetryOf returns the telemetry of the target addr, creating the one of
+// its namespace on first use.
+func (e *Exporter) telemetryOf(addr string) *telemetry {
+	namespace := e.namespaceOf(addr)
+	if namespace == e.namespace {
+		return e.telemetry
+	}
+	e.nsMtx.Lock()
+	defer e.nsMtx.Unlock()
+	t, ok := e.nsTelemetry[namespace]
+	if !ok {
+		opts := e.opts
+		opts.Namespace = namespace
+		t = newTelemetry(opts)
+		e.nsTelemetry[namespace] = t
+	}
+	return t
+}
+
+// collectNamespaced sends the key check metrics and the telemetry of all
+// namespaces.
+func (e *Exporter) collectNamespaced(ch chan<- prometheus.Metric) {
+	e.keyMetrics.collect(ch)
+	e.telemetry.collect(ch)
+	e.nsMtx.Lock()
+	defer e.nsMtx.Unlock()
+	for _, m := range e.nsKeyMetrics {
+		m.collect(ch)
+	}
+	for _, t := range e.nsTelemetry {
+		t.collect(ch)
+	}
+}
+
+// metricsOf returns the metric vectors of namespace, creating them on first
+// use. The caller must hold metricsMtx.
+func (e *Exporter) metricsOf(namespace string) map[string]*prometheus.GaugeVec {
+	if namespace == "" || namespace == e.namespace {
+		return e.metrics
+	}
+	if e.nsMetrics[namespace] == nil {
+		e.nsMetrics[namespace] = map[string]*prometheus.GaugeVec{}
+	}
+	return e.nsMetrics[namespace]
+}
@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// batchCmd is a command of a cmdBatch and its reply once the batch ran.
+type batchCmd struct {
+	name  string
+	args  []interface{}
+	reply interface{}
+	err   error
+}
+
+// cmdBatch collects commands that don't depend on each other's replies, to
+// send them in a single round trip if Options.Pipeline is set.
+type cmdBatch struct {
+	cmds []*batchCmd
+}
+
+// add appends the command name to b and returns it to read its reply after
+// run.
+func (b *cmdBatch) add(name string, args ...interface{}) *batchCmd {
+	cmd := &batchCmd{name: name, args: args}
+	b.cmds = append(b.cmds, cmd)
+	return cmd
+}
+
+// run sends the commands of b on c, pipelined if pipeline is set and there's
+// no redirector, otherwise one by one via r. Error replies are set as err of
+// their command, run only fails if the connection did.
+func (b *cmdBatch) run(r *redirector, c redis.Conn, pipeline bool) error {
+	if !pipeline || r != nil || len(b.cmds) <= 1 {
+		for _, cmd := range b.cmds {
+			cmd.reply, cmd.err = r.do(c, cmd.name, cmd.args...)
+		}
+		return nil
+	}
+
+	for _, cmd := range b.cmds {
+		if err := c.Send(cmd.name, cmd.args...); err != nil {
+			return err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	for _, cmd := range b.cmds {
+		cmd.reply, cmd.err = c.Receive()
+		if _, ok := cmd.err.(redis.Error); cmd.err != nil && !ok {
+			return cmd.err
+		}
+	}
+	return nil
+}
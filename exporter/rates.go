@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateCounters are the counters exported as per second rates too if
+// Options.RateWindow is set, e.g. commands_processed_per_second.
+var rateCounters = []string{
+	"commands_processed_total",
+	"connections_received_total",
+	"net_input_bytes_total",
+	"net_output_bytes_total",
+	"keyspace_hits_total",
+	"keyspace_misses_total",
+	"expired_keys_total",
+	"evicted_keys_total",
+}
+
+// rateName returns the name of the rate of the counter name.
+func rateName(counter string) string {
+	return strings.TrimSuffix(counter, "_total") + "_per_second"
+}
+
+func init() {
+	for _, d := range infoFields {
+		if isRateCounter(d.name) {
+			name := rateName(d.name)
+			metricDescs[name] = metricDesc{name, gaugeMetric, d.help + " per second, averaged over the rate window", d.unit}
+		}
+	}
+}
+
+type rateSample struct {
+	t time.Time
+	v float64
+}
+
+// rateWindows keeps the samples of the rate counters of the last window per
+// host, to compute rates inside the exporter for sinks without rate().
+type rateWindows struct {
+	mtx     sync.Mutex
+	samples map[string][]rateSample
+}
+
+// add records the sample of counter of addr taken at t and returns the rate
+// since the oldest sample within window, false if there's none yet. A value
+// lower than the last one is a counter reset and starts over.
+func (w *rateWindows) add(addr, counter string, t time.Time, v float64, window time.Duration) (float64, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.samples == nil {
+		w.samples = map[string][]rateSample{}
+	}
+	key := addr + "\x00" + counter
+	samples := w.samples[key]
+	if len(samples) > 0 && v < samples[len(samples)-1].v {
+		samples = nil
+	}
+	samples = append(samples, rateSample{t, v})
+	for len(samples) > 2 && t.Sub(samples[1].t) >= window {
+		samples = samples[1:]
+	}
+	w.samples[key] = samples
+
+	first, last := samples[0], samples[len(samples)-1]
+	dt := last.t.Sub(first.t).Seconds()
+	if dt <= 0 {
+		return 0, false
+	}
+	return (last.v - first.v) / dt, true
+}
+
+// withRates returns results with the rates of the rate counters among them
+// appended, results being a fresh scrape of addr taken at t.
+func (e *Exporter) withRates(addr string, t time.Time, results []scrapeResult) []scrapeResult {
+	if e.opts.RateWindow <= 0 {
+		return results
+	}
+	for _, scr := range results {
+		if scr.Addr != addr || len(scr.Labels) > 0 || !isRateCounter(scr.Name) {
+			continue
+		}
+		if rate, ok := e.rates.add(addr, scr.Name, t, scr.Value, e.opts.RateWindow); ok {
+			results = append(results, scrapeResult{Name: rateName(scr.Name), Addr: addr, Value: rate})
+		}
+	}
+	return results
+}
+
+func isRateCounter(name string) bool {
+	for _, c := range rateCounters {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
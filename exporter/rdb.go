@@ -0,0 +1,773 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// opcodes and value types of the RDB format
+const (
+	rdbOpSlotInfo     = 0xF4
+	rdbOpFunction2    = 0xF5
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDB     = 0xFB
+	rdbOpExpireTimeMs = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString           = 0
+	rdbTypeList             = 1
+	rdbTypeSet              = 2
+	rdbTypeZSet             = 3
+	rdbTypeHash             = 4
+	rdbTypeZSet2            = 5
+	rdbTypeModule2          = 7
+	rdbTypeHashZipmap       = 9
+	rdbTypeListZiplist      = 10
+	rdbTypeSetIntset        = 11
+	rdbTypeZSetZiplist      = 12
+	rdbTypeHashZiplist      = 13
+	rdbTypeListQuicklist    = 14
+	rdbTypeStreamListpacks  = 15
+	rdbTypeHashListpack     = 16
+	rdbTypeZSetListpack     = 17
+	rdbTypeListQuicklist2   = 18
+	rdbTypeStreamListpacks2 = 19
+	rdbTypeSetListpack      = 20
+	rdbTypeStreamListpacks3 = 21
+	rdbTypeHashMetadata     = 24
+	rdbTypeHashListpackEx   = 25
+)
+
+// maxRDBStringLength guards against allocating huge buffers for the lengths
+// of corrupt files.
+const maxRDBStringLength = 1 << 32
+
+var errInvalidRDB = errors.New("not an RDB file")
+
+// RDBTypeStats are the keys of a type in a db of an RDB file.
+type RDBTypeStats struct {
+	Keys int64 `json:"keys"`
+	// Elements is the number of elements of collections, 0 for strings
+	// and modules.
+	Elements int64 `json:"elements"`
+	// SerializedBytes is the size of the keys in the file, an estimate of
+	// their memory usage.
+	SerializedBytes int64 `json:"serialized_bytes"`
+}
+
+// RDBDBStats are the keys of a db of an RDB file.
+type RDBDBStats struct {
+	Keys     int64                    `json:"keys"`
+	Expiring int64                    `json:"expiring"`
+	Types    map[string]*RDBTypeStats `json:"types"`
+	// TTLCounts are the cumulative numbers of expiring keys with a TTL up
+	// to the TTLBuckets of the analysis, TTLSum the sum of their TTLs.
+	TTLCounts []uint64 `json:"ttl_counts"`
+	TTLSum    float64  `json:"ttl_sum_seconds"`
+}
+
+// RDBAnalysis is the result of AnalyzeRDB.
+type RDBAnalysis struct {
+	Version      int    `json:"version"`
+	RedisVersion string `json:"redis_version,omitempty"`
+	// Created is the unix time the dump was created, TTLs are relative to
+	// it. 0 if the file doesn't say, TTLs are relative to the analysis then.
+	Created    int64                  `json:"created,omitempty"`
+	DBs        map[string]*RDBDBStats `json:"dbs"`
+	TTLBuckets []float64              `json:"ttl_buckets_seconds"`
+	// Biggest are the biggest keys by SerializedBytes (as MemoryBytes),
+	// Size is their number of elements.
+	Biggest []KeyInfo `json:"biggest"`
+}
+
+// rdbReader reads an RDB file, counting the bytes read.
+type rdbReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (r *rdbReader) readByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+func (r *rdbReader) readFull(n uint64) ([]byte, error) {
+	if n > maxRDBStringLength {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r.r, buf)
+	r.n += int64(read)
+	return buf, err
+}
+
+func (r *rdbReader) skip(n uint64) error {
+	for n > 0 {
+		chunk := n
+		if chunk > math.MaxInt32 {
+			chunk = math.MaxInt32
+		}
+		skipped, err := r.r.Discard(int(chunk))
+		r.n += int64(skipped)
+		if err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// readLen reads a length, encoded is set if it's the kind of a specially
+// encoded string instead.
+func (r *rdbReader) readLen() (uint64, bool, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := r.readByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case 0x80:
+		buf, err := r.readFull(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case 0x81:
+		buf, err := r.readFull(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+	return 0, false, fmt.Errorf("invalid length encoding 0x%x", b)
+}
+
+// length reads a length that must not be a specially encoded string.
+func (r *rdbReader) length() (uint64, error) {
+	n, encoded, err := r.readLen()
+	if err == nil && encoded {
+		err = fmt.Errorf("unexpected string encoding %d", n)
+	}
+	return n, err
+}
+
+// readString reads a string, decoding integers and LZF compressed strings.
+func (r *rdbReader) readString() ([]byte, error) {
+	n, encoded, err := r.readLen()
+	if err != nil || !encoded {
+		if err != nil {
+			return nil, err
+		}
+		return r.readFull(n)
+	}
+	switch n {
+	case 0, 1, 2:
+		buf, err := r.readFull(1 << n)
+		if err != nil {
+			return nil, err
+		}
+		var v int64
+		switch n {
+		case 0:
+			v = int64(int8(buf[0]))
+		case 1:
+			v = int64(int16(binary.LittleEndian.Uint16(buf)))
+		case 2:
+			v = int64(int32(binary.LittleEndian.Uint32(buf)))
+		}
+		return []byte(strconv.FormatInt(v, 10)), nil
+	case 3:
+		clen, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := r.readFull(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, ulen)
+	}
+	return nil, fmt.Errorf("invalid string encoding %d", n)
+}
+
+// skipString skips a string without decoding it.
+func (r *rdbReader) skipString() error {
+	n, encoded, err := r.readLen()
+	if err != nil {
+		return err
+	}
+	if !encoded {
+		return r.skip(n)
+	}
+	switch n {
+	case 0, 1, 2:
+		return r.skip(1 << n)
+	case 3:
+		clen, err := r.length()
+		if err != nil {
+			return err
+		}
+		if _, err := r.length(); err != nil {
+			return err
+		}
+		return r.skip(clen)
+	}
+	return fmt.Errorf("invalid string encoding %d", n)
+}
+
+// skipStrings skips n strings.
+func (r *rdbReader) skipStrings(n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		if err := r.skipString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lzfDecompress decompresses the LZF compressed in of length outLen.
+func lzfDecompress(in []byte, outLen uint64) ([]byte, error) {
+	if outLen > maxRDBStringLength {
+		return nil, fmt.Errorf("invalid length %d", outLen)
+	}
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			end := i + ctrl + 1
+			if end > len(in) {
+				return nil, errors.New("invalid LZF literal")
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+		// back reference of length+2 bytes
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.New("invalid LZF back reference")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("invalid LZF back reference")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("invalid LZF back reference")
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if uint64(len(out)) != outLen {
+		return nil, fmt.Errorf("LZF decompressed to %d bytes, want %d", len(out), outLen)
+	}
+	return out, nil
+}
+
+// encodedCount returns the number of entries of a ziplist, listpack or
+// intset blob, 0 if it's unknown.
+func encodedCount(typ byte, blob []byte) uint64 {
+	switch typ {
+	case rdbTypeListZiplist, rdbTypeZSetZiplist, rdbTypeHashZiplist:
+		// zlbytes, zltail, zllen
+		if len(blob) >= 10 && binary.LittleEndian.Uint16(blob[8:]) != math.MaxUint16 {
+			return uint64(binary.LittleEndian.Uint16(blob[8:]))
+		}
+	case rdbTypeSetIntset:
+		// encoding, length
+		if len(blob) >= 8 {
+			return uint64(binary.LittleEndian.Uint32(blob[4:]))
+		}
+	case rdbTypeHashZipmap:
+		if len(blob) >= 1 && blob[0] < 254 {
+			return uint64(blob[0])
+		}
+	default:
+		// listpacks: total bytes, number of elements
+		if len(blob) >= 6 && binary.LittleEndian.Uint16(blob[4:]) != math.MaxUint16 {
+			return uint64(binary.LittleEndian.Uint16(blob[4:]))
+		}
+	}
+	return 0
+}
+
+// rdbTypeName returns the redis type of the RDB value type typ.
+func rdbTypeName(typ byte) string {
+	switch typ {
+	case rdbTypeString:
+		return "string"
+	case rdbTypeList, rdbTypeListZiplist, rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		return "list"
+	case rdbTypeSet, rdbTypeSetIntset, rdbTypeSetListpack:
+		return "set"
+	case rdbTypeZSet, rdbTypeZSet2, rdbTypeZSetZiplist, rdbTypeZSetListpack:
+		return "zset"
+	case rdbTypeHash, rdbTypeHashZipmap, rdbTypeHashZiplist, rdbTypeHashListpack, rdbTypeHashMetadata, rdbTypeHashListpackEx:
+		return "hash"
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return "stream"
+	case rdbTypeModule2:
+		return "module"
+	}
+	return ""
+}
+
+// skipValue skips a value of type typ and returns its number of elements.
+func (r *rdbReader) skipValue(typ byte) (uint64, error) {
+	switch typ {
+	case rdbTypeString:
+		return 0, r.skipString()
+	case rdbTypeList, rdbTypeSet:
+		n, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		return n, r.skipStrings(n)
+	case rdbTypeHash:
+		n, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		return n, r.skipStrings(2 * n)
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := r.skipString(); err != nil {
+				return 0, err
+			}
+			if typ == rdbTypeZSet2 {
+				err = r.skip(8)
+			} else {
+				// length prefixed string, 253 to 255 are NaN and infinities
+				var l byte
+				if l, err = r.readByte(); err == nil && l < 253 {
+					err = r.skip(uint64(l))
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+	case rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeZSetZiplist, rdbTypeHashZiplist,
+		rdbTypeHashListpack, rdbTypeZSetListpack, rdbTypeSetListpack:
+		blob, err := r.readString()
+		if err != nil {
+			return 0, err
+		}
+		n := encodedCount(typ, blob)
+		if typ == rdbTypeZSetZiplist || typ == rdbTypeHashZiplist || typ == rdbTypeHashListpack || typ == rdbTypeZSetListpack {
+			// members and scores, fields and values
+			n /= 2
+		}
+		return n, nil
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		nodes, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		var n uint64
+		for i := uint64(0); i < nodes; i++ {
+			container := uint64(2)
+			if typ == rdbTypeListQuicklist2 {
+				if container, err = r.length(); err != nil {
+					return 0, err
+				}
+			}
+			blob, err := r.readString()
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case typ == rdbTypeListQuicklist:
+				n += encodedCount(rdbTypeListZiplist, blob)
+			case container == 1:
+				// a plain node holds a single large element
+				n++
+			default:
+				n += encodedCount(rdbTypeSetListpack, blob)
+			}
+		}
+		return n, nil
+	case rdbTypeHashMetadata:
+		// the minimum expire time, then the TTL, field and value of every field
+		if err := r.skip(8); err != nil {
+			return 0, err
+		}
+		n, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.length(); err != nil {
+				return 0, err
+			}
+			if err := r.skipStrings(2); err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+	case rdbTypeHashListpackEx:
+		// the minimum expire time, then a listpack of field, value, TTL
+		if err := r.skip(8); err != nil {
+			return 0, err
+		}
+		blob, err := r.readString()
+		if err != nil {
+			return 0, err
+		}
+		return encodedCount(rdbTypeSetListpack, blob) / 3, nil
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return r.skipStream(typ)
+	case rdbTypeModule2:
+		if _, err := r.length(); err != nil {
+			return 0, err
+		}
+		return 0, r.skipModuleValue()
+	}
+	return 0, fmt.Errorf("unsupported value type %d", typ)
+}
+
+// skipStream skips a stream and returns its length.
+func (r *rdbReader) skipStream(typ byte) (uint64, error) {
+	listpacks, err := r.length()
+	if err != nil {
+		return 0, err
+	}
+	if err := r.skipStrings(2 * listpacks); err != nil {
+		return 0, err
+	}
+	// length, last id
+	length, err := r.length()
+	if err != nil {
+		return 0, err
+	}
+	lens := 2
+	if typ >= rdbTypeStreamListpacks2 {
+		// first id, max deleted id, entries added
+		lens += 5
+	}
+	if err := r.skipLengths(lens); err != nil {
+		return 0, err
+	}
+
+	groups, err := r.length()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		// name, last id and entries read
+		if err := r.skipString(); err != nil {
+			return 0, err
+		}
+		lens := 2
+		if typ >= rdbTypeStreamListpacks2 {
+			lens++
+		}
+		if err := r.skipLengths(lens); err != nil {
+			return 0, err
+		}
+		// pending entries: id, delivery time and count
+		pending, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		for j := uint64(0); j < pending; j++ {
+			if err := r.skip(16 + 8); err != nil {
+				return 0, err
+			}
+			if _, err := r.length(); err != nil {
+				return 0, err
+			}
+		}
+		// consumers: name, seen and active time, pending ids
+		consumers, err := r.length()
+		if err != nil {
+			return 0, err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			if err := r.skipString(); err != nil {
+				return 0, err
+			}
+			times := uint64(8)
+			if typ >= rdbTypeStreamListpacks3 {
+				times += 8
+			}
+			if err := r.skip(times); err != nil {
+				return 0, err
+			}
+			ids, err := r.length()
+			if err != nil {
+				return 0, err
+			}
+			if err := r.skip(16 * ids); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return length, nil
+}
+
+func (r *rdbReader) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipModuleValue skips the opcodes of a module value up to its EOF.
+func (r *rdbReader) skipModuleValue() error {
+	for {
+		op, err := r.length()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case 0:
+			return nil
+		case 1, 2:
+			_, err = r.length()
+		case 3:
+			err = r.skip(4)
+		case 4:
+			err = r.skip(8)
+		case 5:
+			err = r.skipString()
+		default:
+			err = fmt.Errorf("invalid module opcode %d", op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// AnalyzeRDB parses the RDB dump read from f and returns its keyspace
+// statistics together with the top biggest keys by size in the file.
+func AnalyzeRDB(f io.Reader, top int) (RDBAnalysis, error) {
+	res := RDBAnalysis{DBs: map[string]*RDBDBStats{}, TTLBuckets: durationBuckets, Biggest: []KeyInfo{}}
+	r := &rdbReader{r: bufio.NewReader(f)}
+	magic, err := r.readFull(9)
+	if err != nil || string(magic[:5]) != "REDIS" {
+		return res, errInvalidRDB
+	}
+	if res.Version, err = strconv.Atoi(string(magic[5:])); err != nil {
+		return res, errInvalidRDB
+	}
+
+	biggest := biggestKeys{n: top}
+	db := "0"
+	var expireMs int64
+	for {
+		op, err := r.readByte()
+		if err != nil {
+			return res, err
+		}
+		switch op {
+		case rdbOpEOF:
+			res.Biggest = append(res.Biggest, biggest.keys...)
+			return res, nil
+		case rdbOpAux:
+			key, err := r.readString()
+			if err != nil {
+				return res, err
+			}
+			value, err := r.readString()
+			if err != nil {
+				return res, err
+			}
+			switch string(key) {
+			case "redis-ver":
+				res.RedisVersion = string(value)
+			case "ctime":
+				res.Created, _ = strconv.ParseInt(string(value), 10, 64)
+			}
+		case rdbOpSelectDB:
+			n, err := r.length()
+			if err != nil {
+				return res, err
+			}
+			db = strconv.FormatUint(n, 10)
+		case rdbOpResizeDB:
+			err = r.skipLengths(2)
+		case rdbOpSlotInfo:
+			err = r.skipLengths(3)
+		case rdbOpExpireTime:
+			var buf []byte
+			if buf, err = r.readFull(4); err == nil {
+				expireMs = int64(binary.LittleEndian.Uint32(buf)) * 1000
+			}
+		case rdbOpExpireTimeMs:
+			var buf []byte
+			if buf, err = r.readFull(8); err == nil {
+				expireMs = int64(binary.LittleEndian.Uint64(buf))
+			}
+		case rdbOpIdle:
+			_, err = r.length()
+		case rdbOpFreq:
+			_, err = r.readByte()
+		case rdbOpFunction2:
+			err = r.skipString()
+		case rdbOpModuleAux:
+			// module id, when opcode and when
+			if err = r.skipLengths(3); err == nil {
+				err = r.skipModuleValue()
+			}
+		default:
+			typ := rdbTypeName(op)
+			if typ == "" {
+				return res, fmt.Errorf("unsupported value type or opcode 0x%x at offset %d", op, r.n-1)
+			}
+			start := r.n - 1
+			key, err := r.readString()
+			if err != nil {
+				return res, err
+			}
+			elements, err := r.skipValue(op)
+			if err != nil {
+				return res, fmt.Errorf("key %q: %s", key, err)
+			}
+			info := KeyInfo{DB: db, Key: string(key), Type: typ, Size: int64(elements), MemoryBytes: r.n - start}
+			res.add(info, expireMs)
+			biggest.add(info)
+			expireMs = 0
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+}
+
+// add counts the key info expiring at expireMs, 0 if it doesn't expire.
+func (a *RDBAnalysis) add(info KeyInfo, expireMs int64) {
+	db, ok := a.DBs[info.DB]
+	if !ok {
+		db = &RDBDBStats{Types: map[string]*RDBTypeStats{}, TTLCounts: make([]uint64, len(a.TTLBuckets))}
+		a.DBs[info.DB] = db
+	}
+	t, ok := db.Types[info.Type]
+	if !ok {
+		t = &RDBTypeStats{}
+		db.Types[info.Type] = t
+	}
+	db.Keys++
+	t.Keys++
+	t.Elements += info.Size
+	t.SerializedBytes += info.MemoryBytes
+	if expireMs == 0 {
+		return
+	}
+
+	created := a.Created
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+	ttl := math.Max(0, float64(expireMs)/1000-float64(created))
+	db.Expiring++
+	db.TTLSum += ttl
+	for i, b := range a.TTLBuckets {
+		if ttl <= b {
+			db.TTLCounts[i]++
+		}
+	}
+}
+
+// rdbCollector exports an RDBAnalysis.
+type rdbCollector struct {
+	a                                        RDBAnalysis
+	keys, elements, bytes, expiring, created *prometheus.Desc
+	ttl, biggest                             *prometheus.Desc
+}
+
+// NewRDBCollector returns a collector of the metrics of a, e.g. to print
+// them in the Prometheus text format.
+func NewRDBCollector(a RDBAnalysis, namespace string) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "rdb", name), help, labels, nil)
+	}
+	return &rdbCollector{
+		a:        a,
+		keys:     desc("keys", "Number of keys in the dump by db and type", "db", "type"),
+		elements: desc("elements", "Number of elements of the collections in the dump by db and type", "db", "type"),
+		bytes:    desc("serialized_bytes", "Size of the keys in the dump by db and type, an estimate of their memory usage", "db", "type"),
+		expiring: desc("keys_expiring", "Number of keys with an expire time in the dump by db", "db"),
+		created:  desc("created_timestamp_seconds", "Time the dump was created"),
+		ttl:      desc("key_ttl_seconds", "TTL of the expiring keys in the dump at the time it was created by db", "db"),
+		biggest:  desc("biggest_key_serialized_bytes", "Size of the biggest keys in the dump", "db", "key", "type"),
+	}
+}
+
+func (c *rdbCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.keys, c.elements, c.bytes, c.expiring, c.created, c.ttl, c.biggest} {
+		ch <- d
+	}
+}
+
+func (c *rdbCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.a.Created > 0 {
+		ch <- prometheus.MustNewConstMetric(c.created, prometheus.GaugeValue, float64(c.a.Created))
+	}
+	var dbs []string
+	for db := range c.a.DBs {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	for _, db := range dbs {
+		stats := c.a.DBs[db]
+		for typ, t := range stats.Types {
+			ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(t.Keys), "db"+db, typ)
+			ch <- prometheus.MustNewConstMetric(c.elements, prometheus.GaugeValue, float64(t.Elements), "db"+db, typ)
+			ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(t.SerializedBytes), "db"+db, typ)
+		}
+		ch <- prometheus.MustNewConstMetric(c.expiring, prometheus.GaugeValue, float64(stats.Expiring), "db"+db)
+		buckets := map[float64]uint64{}
+		for i, b := range c.a.TTLBuckets {
+			buckets[b] = stats.TTLCounts[i]
+		}
+		ch <- prometheus.MustNewConstHistogram(c.ttl, uint64(stats.Expiring), stats.TTLSum, buckets, "db"+db)
+	}
+	for _, k := range c.a.Biggest {
+		ch <- prometheus.MustNewConstMetric(c.biggest, prometheus.GaugeValue, float64(k.MemoryBytes), "db"+k.DB, sanitizeLabelValue(k.Key), k.Type)
+	}
+}
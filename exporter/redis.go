@@ -1,11 +1,17 @@
 package exporter
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/url"
+	"regexp"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -21,178 +27,707 @@ type RedisHost struct {
 
 type dbKeyPair struct {
 	db, key string
+
+	// addr scopes the key to a single redis node, "" checks it on all
+	addr string
+
+	// bitmap keys additionally export their number of set bits
+	bitmap bool
+
+	// geo keys export their number of members, and the number of members
+	// within radius if set
+	geo    bool
+	radius *geoRadius
+
+	// valueLabel keys export their value as label of key_value_info
+	valueLabel bool
+
+	// hashFields keys export each numeric field as key_hash_field_value
+	hashFields bool
+
+	// fieldTTL keys export the TTLs of these hash fields
+	fieldTTL *hashFieldTTL
+
+	// memberPatterns sets and sorted sets export the number of members
+	// matching each pattern
+	memberPatterns *memberPatterns
 }
 
 // Exporter implements the prometheus.Exporter interface, and exports Redis metrics.
 type Exporter struct {
-	redis        RedisHost
-	namespace    string
-	keys         []dbKeyPair
-	keyValues    *prometheus.GaugeVec
-	keySizes     *prometheus.GaugeVec
+	redis       RedisHost
+	namespace   string
+	keys        []dbKeyPair
+	keysMtx     sync.RWMutex
+	keyGroups   []keyGroup
+	keyspaceDBs []string
+	*keyMetrics
 	duration     prometheus.Gauge
 	scrapeErrors prometheus.Gauge
 	totalScrapes prometheus.Counter
 	metrics      map[string]*prometheus.GaugeVec
+	nsMetrics    map[string]map[string]*prometheus.GaugeVec
 	metricsMtx   sync.RWMutex
+	// nsKeyMetrics and nsTelemetry are the key check metrics and telemetry
+	// of the namespaces of Options.NamespaceMap, guarded by nsMtx
+	nsKeyMetrics map[string]*keyMetrics
+	nsTelemetry  map[string]*telemetry
+	nsMtx        sync.Mutex
+	rates        rateWindows
+	scans        scanStates
+	deltas       counterDeltas
+	limiter      *ScrapeLimiter
+	flights      flightGroup
+	cache        resultCache
+	keyCache     resultCache
+	cacheTTL     time.Duration
+	tlsConfig    *tls.Config
+	progress     scrapeProgress
+	opts         Options
+	slots        slotSampler
+	replicas     replicaSet
+	telemetry    *telemetry
+	statuses     targetStatuses
+	nodeFeatures nodeFeatures
+	watchdog     failureWatchdog
 	sync.RWMutex
 }
 
-type scrapeResult struct {
-	Name  string
-	Value float64
-	Addr  string
-	DB    string
-}
-
-var (
-	metricMap = map[string]string{
-		// # Server
-		"uptime_in_seconds": "uptime_in_seconds",
-
-		// # Clients
-		"connected_clients": "connected_clients",
-		"blocked_clients":   "blocked_clients",
-
-		// # Memory
-		"used_memory":             "memory_used_bytes",
-		"used_memory_rss":         "memory_used_rss_bytes",
-		"used_memory_peak":        "memory_used_peak_bytes",
-		"used_memory_lua":         "memory_used_lua_bytes",
-		"max_memory":              "memory_max_bytes",
-		"mem_fragmentation_ratio": "memory_fragmentation_ratio",
-
-		// # Persistence
-		"rdb_changes_since_last_save":  "rdb_changes_since_last_save",
-		"rdb_last_bgsave_time_sec":     "rdb_last_bgsave_duration_sec",
-		"rdb_current_bgsave_time_sec":  "rdb_current_bgsave_duration_sec",
-		"aof_enabled":                  "aof_enabled",
-		"aof_rewrite_in_progress":      "aof_rewrite_in_progress",
-		"aof_rewrite_scheduled":        "aof_rewrite_scheduled",
-		"aof_last_rewrite_time_sec":    "aof_last_rewrite_duration_sec",
-		"aof_current_rewrite_time_sec": "aof_current_rewrite_duration_sec",
-
-		// # Stats
-		"total_connections_received": "connections_received_total",
-		"total_commands_processed":   "commands_processed_total",
-		"total_net_input_bytes":      "net_input_bytes_total",
-		"total_net_output_bytes":     "net_output_bytes_total",
-		"rejected_connections":       "rejected_connections_total",
-		"expired_keys":               "expired_keys_total",
-		"evicted_keys":               "evicted_keys_total",
-		"keyspace_hits":              "keyspace_hits_total",
-		"keyspace_misses":            "keyspace_misses_total",
-		"pubsub_channels":            "pubsub_channels",
-		"pubsub_patterns":            "pubsub_patterns",
-
-		// # Replication
-		"loading":           "loading_dump_file",
-		"connected_slaves":  "connected_slaves",
-		"repl_backlog_size": "replication_backlog_bytes",
-
-		// # CPU
-		"used_cpu_sys":           "used_cpu_sys",
-		"used_cpu_user":          "used_cpu_user",
-		"used_cpu_sys_children":  "used_cpu_sys_children",
-		"used_cpu_user_children": "used_cpu_user_children",
-
-		// # Cluster
-		"cluster_stats_messages_sent":   "cluster_messages_sent_total",
-		"cluster_stats_messages_received":   "cluster_messages_received_total",
+// Options holds the optional settings of an Exporter.
+type Options struct {
+	Namespace string
+	CheckKeys string
+
+	// Limiter bounds how many redis hosts are scraped at the same time,
+	// it can be shared by several exporters. nil means no limit.
+	Limiter *ScrapeLimiter
+
+	// CacheTTL is how long the results of scraping a redis host are
+	// served to subsequent Collect calls before querying it again.
+	CacheTTL time.Duration
+
+	// MinScrapeInterval is the minimum time between two scrapes of the same
+	// redis host, Collect calls arriving faster are served cached results.
+	MinScrapeInterval time.Duration
+
+	// TLSConfig is used when connecting to rediss:// addresses.
+	TLSConfig *tls.Config
+
+	// CommandStatsTopN limits the per command metrics to the N commands with
+	// the most calls, the rest is summed up as cmd="other". 0 exports all commands.
+	CommandStatsTopN int
+
+	// CommandStatsCommands limits the per command metrics to these commands
+	// (lowercase, subcommands like config|get are included by their parent
+	// command), the rest is summed up as cmd="other". See ParseCommands.
+	CommandStatsCommands []string
+
+	// DBAggregateThreshold sums up the keyspace metrics of all databases with
+	// an index >= DBAggregateThreshold as db="other". 0 disables aggregation.
+	DBAggregateThreshold int
+
+	// ClusterKeyspaceTotals additionally exports the keyspace metrics summed
+	// up across all scraped cluster masters as cluster_db_keys{db=...}.
+	ClusterKeyspaceTotals bool
+
+	// ClusterSlotSamples is the number of slots owned by a cluster master whose
+	// number of keys is sampled per scrape (via CLUSTER COUNTKEYSINSLOT), the
+	// distribution of keys across the slots is exported. 0 disables sampling.
+	ClusterSlotSamples int
+
+	// WaitProbeReplicas enables writing a probe key to every master and
+	// waiting for that many replicas to acknowledge it via WAIT, for at most
+	// WaitProbeTimeout. 0 disables the probe.
+	WaitProbeReplicas int
+	WaitProbeTimeout  time.Duration
+
+	// MonitorSampleDuration attaches MONITOR to every node for this long per
+	// scrape to export the observed command mix and key prefixes. 0 disables it.
+	MonitorSampleDuration time.Duration
+
+	// KeyDebugObjectFallback uses the serializedlength of DEBUG OBJECT as
+	// key_memory_usage_bytes of checked keys on redis versions without
+	// MEMORY USAGE (before 4.0).
+	KeyDebugObjectFallback bool
+
+	// CheckBitmapKeys are checked like CheckKeys (same format) and
+	// additionally export their number of set bits via BITCOUNT.
+	CheckBitmapKeys string
+
+	// CheckGeoKeys are checked like CheckKeys and export their number of
+	// members, entries may end in @<lon>:<lat>:<radius><unit> to also
+	// export the number of members within that radius.
+	CheckGeoKeys string
+
+	// CheckValueLabelKeys are checked like CheckKeys and export their string
+	// value as label of key_value_info, for categorical values like feature
+	// flags. Values are cut to maxValueLabelLength.
+	CheckValueLabelKeys string
+
+	// CheckHashFieldKeys are hashes used as a bag of metrics, every numeric
+	// field is exported as key_hash_field_value{field=...}. Hashes with more
+	// than maxHashFields fields are skipped.
+	CheckHashFieldKeys string
+
+	// CheckHashFieldTTLKeys are hashes whose listed fields export their TTL
+	// (hash field expiration, redis 7.4) as key_hash_field_ttl_seconds,
+	// entries are of the form [db<n>=]<key>@<field>[:<field>...].
+	CheckHashFieldTTLKeys string
+
+	// CheckMemberPatternKeys are sets and sorted sets exporting the number of
+	// members matching a pattern (via SSCAN or ZSCAN MATCH) as
+	// key_members_matching, entries are of the form [db<n>=]<key>@<pattern>.
+	CheckMemberPatternKeys string
+
+	// CountKeyGroups lists prefixes whose keys are counted (and their memory
+	// usage summed up) per db by SCANning it, e.g. db0=user:,session:;db3=cache:
+	CountKeyGroups string
+
+	// CheckKeysGlob treats check-keys entries containing glob characters (*,
+	// ? and [) as patterns, the keys matching them are found via SCAN.
+	// Otherwise all entries are keys checked as they are.
+	CheckKeysGlob bool
+
+	// CheckKeysGlobLimit is the maximum number of keys checked per check-keys
+	// pattern, defaults to defaultGlobLimit.
+	CheckKeysGlobLimit int
+
+	// ScanCount is the COUNT hint of the SCAN calls of check-keys patterns,
+	// key groups and ScanKeys, defaults to defaultScanCount. Lower values mean
+	// shorter blocking of redis per call but more calls.
+	ScanCount int
+
+	// KeyMemorySamples is the number of elements of collections MEMORY USAGE
+	// samples for checked keys and key groups. 0 uses the redis default (5),
+	// negative values sample all elements.
+	KeyMemorySamples int
+
+	// Dialer opens the connections to redis, e.g. to set connect timeouts,
+	// TCP keepalive or the local address. nil uses the redigo defaults.
+	Dialer *net.Dialer
+
+	// DialHosts maps host names to the IP their connections are dialed at
+	// instead of resolving the name, e.g. the address an allowlist of
+	// networks was checked against.
+	DialHosts map[string]string
+
+	// ResetAfterFailures resets the state kept about a node between scrapes
+	// after that many failed scrapes of it in a row, see resetTarget.
+	// 0 never resets it.
+	ResetAfterFailures int
+
+	// Failover treats the addresses of the RedisHost as a prioritized list of
+	// endpoints of a single instance: only the first reachable one is scraped.
+	Failover bool
+
+	// DiscoverReplicas also scrapes the replicas listed in the INFO of the
+	// scraped masters, unless they are configured themselves.
+	DiscoverReplicas bool
+
+	// MetricHelp overrides the HELP text of metrics by name (without the
+	// namespace), MetricDocURLs adds a documentation URL to it, e.g. links
+	// to internal runbooks.
+	MetricHelp    map[string]string
+	MetricDocURLs map[string]string
+
+	// MaxSeriesPerTarget caps the number of series exported per redis node,
+	// the overflow is dropped and counted in exporter_series_dropped_total.
+	// The key check metrics aren't part of it, see CheckKeysGlobLimit.
+	// 0 means no limit.
+	MaxSeriesPerTarget int
+
+	// Replay treats the addresses of the RedisHost as files with recorded
+	// INFO responses and serves the metrics parsed from them instead of
+	// connecting to redis, for testing the parser against captured outputs.
+	Replay bool
+
+	// Credentials, if set, is asked for the credentials of a configured
+	// redis address whenever a connection to it is opened. Credentials in the
+	// user info of the address take precedence, the password of the RedisHost
+	// is used if it returns an empty password.
+	Credentials CredentialProvider
+
+	// Leader, if set, reports whether this exporter is the active one of
+	// several redundant replicas. Only the leader runs the parts of a scrape
+	// that write to redis or are expensive for it, the key group and keyspace
+	// sample SCANs, the WAIT probe and MONITOR sampling, the standbys export
+	// everything else.
+	Leader func() bool
+
+	// NamespaceMap exports the metrics of the configured addresses it
+	// contains, including their key checks and telemetry, under the given
+	// namespace instead of Namespace, e.g. to match the dashboards of
+	// instances previously scraped by separate exporters.
+	NamespaceMap map[string]string
+
+	// Sections, if set, restricts scrapes to these INFO sections and the
+	// collectors "config" (CONFIG based metrics) and "keys" (key checks and
+	// key groups), e.g. for frequent lightweight probes. The WAIT probe and
+	// MONITOR sampling only run if it's empty. See ValidateSections.
+	Sections []string
+
+	// RateWindow, if set, additionally exports per second rates of some
+	// counters (commands processed, keyspace hits and misses, network bytes
+	// ...) averaged over this window, for sinks without rate().
+	RateWindow time.Duration
+
+	// Deltas exports counters as gauges of their increase since the
+	// previous scrape of the node instead of their cumulative value, for
+	// push based sinks expecting deltas. Counters are left out of the first
+	// scrape of a node.
+	Deltas bool
+
+	// KeyspaceSample lists dbs, e.g. db0,db3, whose keys are SCANned on every
+	// scrape, looking at no more than KeyspaceSampleLimit keys each
+	// (defaults to defaultKeyspaceSampleLimit), to export the distribution
+	// of their memory usage as histogram with the KeySizeBuckets (defaults
+	// to defaultKeySizeBuckets).
+	KeyspaceSample      string
+	KeyspaceSampleLimit int
+	KeySizeBuckets      []float64
+
+	// KeyspaceTopN additionally exports the N biggest of the sampled keys
+	// of every db by memory usage as biggest_key_bytes{key=...,type=...}.
+	// 0 disables it.
+	KeyspaceTopN int
+
+	// KeyspaceIdleTime additionally exports the distribution of the OBJECT
+	// IDLETIME of the sampled keys, showing how much of the dataset is cold.
+	// It isn't tracked with an LFU maxmemory-policy.
+	KeyspaceIdleTime bool
+
+	// ScanThrottle, if set, paces all SCANs of the keyspace to a number of
+	// keys per second, it can be shared by several exporters. nil means no
+	// limit.
+	ScanThrottle *ScanThrottle
+
+	// ScanChunk, if set, spreads the key group SCANs of large dbs over
+	// several scrapes: no more than about ScanChunk keys are looked at per
+	// scrape, the next scrape resumes from the saved cursor and the counts of
+	// the last complete pass are exported. Keyspace sampling resumes from
+	// the saved cursor as well, sampling other keys on every scrape.
+	ScanChunk int
+
+	// Pipeline sends the CONFIG GET commands and the commands checking keys
+	// in pipelined batches instead of one by one, saving round trips to
+	// distant nodes. Key checks following cluster redirects aren't
+	// pipelined.
+	Pipeline bool
+
+	// KeyCacheTTL, if set, is how long the key checks and the results of the
+	// key group and keyspace sample SCANs of a node are reused before
+	// running them again, e.g. to refresh key sizes every 5 minutes while
+	// INFO is scraped every time. Checked keys keep their last values.
+	KeyCacheTTL time.Duration
+
+	// MinimalTargets are the configured addresses only checked via PING,
+	// without INFO, e.g. protocol compatible proxies rejecting INFO. Only up
+	// and ping_duration_seconds are exported for them.
+	MinimalTargets map[string]bool
+
+	// CommandTimeout, if set, is the read and write timeout of the
+	// connections to redis, failing the commands of a scrape that take
+	// longer.
+	CommandTimeout time.Duration
+
+	// TargetTimeouts override the connect timeout of Dialer and
+	// CommandTimeout per address.
+	TargetTimeouts map[string]Timeouts
+
+	// ScrapeInterval is the interval of the background scrapes of
+	// ScrapeInBackground, ScrapeJitter (0 to 1) the fraction of it every
+	// interval is randomly shortened or prolonged by.
+	ScrapeInterval time.Duration
+	ScrapeJitter   float64
+
+	// DiscoverInfoFields exports the numeric INFO fields the exporter doesn't
+	// know (e.g. of newer redis versions or modules) as info_<field>.
+	DiscoverInfoFields bool
+
+	// Tracer, if set, traces the scrapes, see NewTracer.
+	Tracer *Tracer
+}
+
+// Timeouts are the timeouts of the connections to a redis node, 0 keeps the
+// default.
+type Timeouts struct {
+	Connect, Command time.Duration
+}
+
+// helpText returns the HELP text of the metric name, def unless it's
+// overridden by opts.MetricHelp, followed by its documentation URL if any.
+func helpText(opts Options, name, def string) string {
+	help := def
+	if h, ok := opts.MetricHelp[name]; ok {
+		help = h
 	}
-)
+	if url, ok := opts.MetricDocURLs[name]; ok {
+		help = strings.TrimSpace(help + " See " + url)
+	}
+	return help
+}
+
+// metricHelp returns the help of the metric name, which tells if a counter
+// is exported as delta, see Options.Deltas.
+func (e *Exporter) metricHelp(name string) string {
+	help := helpText(e.opts, name, describeMetric(name).helpText())
+	if e.opts.Deltas && describeMetric(name).typ == counterMetric {
+		help = strings.TrimSpace(help + " (increase since the previous scrape)")
+	}
+	return help
+}
+
+type scrapeResult struct {
+	Name   string
+	Value  float64
+	Addr   string
+	DB     string
+	Cmd    string
+	Labels map[string]string
+
+	// Namespace overrides the namespace of the exporter, see
+	// Options.NamespaceMap.
+	Namespace string
+}
 
 func (e *Exporter) initGauges() {
 
 	e.metrics = map[string]*prometheus.GaugeVec{}
-	e.metrics["db_keys"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: e.namespace,
-		Name:      "db_keys",
-		Help:      "Total number of keys by DB",
-	}, []string{"addr", "db"})
-	e.metrics["db_keys_expiring"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: e.namespace,
-		Name:      "db_keys_expiring",
-		Help:      "Total number of expiring keys by DB",
-	}, []string{"addr", "db"})
-	e.metrics["db_avg_ttl_seconds"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: e.namespace,
-		Name:      "db_avg_ttl_seconds",
-		Help:      "Avg TTL in seconds",
-	}, []string{"addr", "db"})
-
-	// Emulate a Summary.
-	e.metrics["command_call_duration_seconds_count"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: e.namespace,
-		Name:      "command_call_duration_seconds_count",
-		Help:      "Total number of calls per command",
-	}, []string{"addr", "cmd"})
-	e.metrics["command_call_duration_seconds_sum"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: e.namespace,
-		Name:      "command_call_duration_seconds_sum",
-		Help:      "Total amount of time in seconds spent per command",
-	}, []string{"addr", "cmd"})
+	e.nsMetrics = map[string]map[string]*prometheus.GaugeVec{}
+	for name, labels := range map[string][]string{
+		"db_keys":                  {"addr", "db"},
+		"db_keys_expiring":         {"addr", "db"},
+		"db_avg_ttl_seconds":       {"addr", "db"},
+		"cluster_db_keys":          {"db"},
+		"cluster_db_keys_expiring": {"db"},
+
+		// Emulate a Summary.
+		"command_call_duration_seconds_count": {"addr", "cmd"},
+		"command_call_duration_seconds_sum":   {"addr", "cmd"},
+	} {
+		e.metrics[name] = e.newMetricVec(name, labels)
+	}
+}
+
+// newMetricVec returns the vector of the metric name, described by
+// metricDescs.
+func (e *Exporter) newMetricVec(name string, labels []string) *prometheus.GaugeVec {
+	return e.newMetricVecIn(e.namespace, name, labels)
+}
+
+// newMetricVecIn is newMetricVec for a namespace other than the one of the
+// exporter.
+func (e *Exporter) newMetricVecIn(namespace, name string, labels []string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      e.metricHelp(name),
+	}, labels)
 }
 
 // NewRedisExporter returns a new exporter of Redis metrics.
-// note to self: next time we add an argument, instead add a RedisExporter struct
 func NewRedisExporter(host RedisHost, namespace, checkKeys string) (*Exporter, error) {
+	return NewRedisExporterWithOptions(host, Options{Namespace: namespace, CheckKeys: checkKeys})
+}
+
+// NewRedisExporterWithOptions returns a new exporter of Redis metrics configured by opts.
+func NewRedisExporterWithOptions(host RedisHost, opts Options) (*Exporter, error) {
+	namespace := opts.Namespace
+	checkKeys := opts.CheckKeys
 
 	e := Exporter{
-		redis:     host,
-		namespace: namespace,
-		keyValues: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "key_value",
-			Help:      "The value of \"key\"",
-		}, []string{"db", "key"}),
-		keySizes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "key_size",
-			Help:      "The length or size of \"key\"",
-		}, []string{"db", "key"}),
+		redis:      dedupeRedisHost(host),
+		namespace:  namespace,
+		limiter:    opts.Limiter,
+		cacheTTL:   opts.CacheTTL,
+		tlsConfig:  opts.TLSConfig,
+		opts:       opts,
+		keyMetrics: newKeyMetrics(namespace, opts),
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "exporter_last_scrape_duration_seconds",
-			Help:      "The last scrape duration.",
+			Help:      helpText(opts, "exporter_last_scrape_duration_seconds", "The last scrape duration."),
 		}),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "exporter_scrapes_total",
-			Help:      "Current total redis scrapes.",
+			Help:      helpText(opts, "exporter_scrapes_total", "Current total redis scrapes."),
 		}),
 		scrapeErrors: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "exporter_last_scrape_error",
-			Help:      "The last scrape error status.",
+			Help:      helpText(opts, "exporter_last_scrape_error", "The last scrape error status."),
 		}),
 	}
+	e.telemetry = newTelemetry(opts)
+	e.nsKeyMetrics = map[string]*keyMetrics{}
+	e.nsTelemetry = map[string]*telemetry{}
+
+	if err := validateKeyLists(checkKeys, opts); err != nil {
+		return nil, err
+	}
+	e.keys = buildCheckKeys(checkKeys, opts)
+	groups, err := parseKeyGroups(opts.CountKeyGroups)
+	if err != nil {
+		return nil, err
+	}
+	e.keyGroups = groups
+	if e.keyspaceDBs, err = parseDBs(opts.KeyspaceSample); err != nil {
+		return nil, err
+	}
+
+	if opts.MinScrapeInterval > e.cacheTTL {
+		e.cacheTTL = opts.MinScrapeInterval
+	}
+	if ttl := backgroundCacheTTL(opts); ttl > e.cacheTTL {
+		e.cacheTTL = ttl
+	}
+
+	e.initGauges()
+	return &e, nil
+}
+
+// validateKeyLists returns an error describing the first malformed entry of
+// checkKeys and the special purpose key lists of opts.
+func validateKeyLists(checkKeys string, opts Options) error {
+	for _, l := range []struct {
+		name, keys string
+		validate   func(string) error
+	}{
+		{"check-keys", checkKeys, ValidateCheckKeys},
+		{"check-bitmap-keys", opts.CheckBitmapKeys, ValidateCheckKeys},
+		{"check-value-label-keys", opts.CheckValueLabelKeys, ValidateCheckKeys},
+		{"check-hash-field-keys", opts.CheckHashFieldKeys, ValidateCheckKeys},
+		{"check-geo-keys", opts.CheckGeoKeys, ValidateGeoCheckKeys},
+		{"check-hash-field-ttl-keys", opts.CheckHashFieldTTLKeys, ValidateHashFieldTTLKeys},
+		{"check-member-pattern-keys", opts.CheckMemberPatternKeys, ValidateMemberPatternKeys},
+	} {
+		if err := l.validate(l.keys); err != nil {
+			return fmt.Errorf("%s: %s", l.name, err)
+		}
+	}
+	return nil
+}
+
+// buildCheckKeys returns the keys to check, checkKeys and the special
+// purpose key lists of opts merged.
+func buildCheckKeys(checkKeys string, opts Options) []dbKeyPair {
+	keys := parseCheckKeys(checkKeys)
+	for _, k := range parseCheckKeys(opts.CheckBitmapKeys) {
+		k.bitmap = true
+		keys = addCheckKey(keys, k)
+	}
+	for _, k := range parseCheckKeys(opts.CheckValueLabelKeys) {
+		k.valueLabel = true
+		keys = addCheckKey(keys, k)
+	}
+	for _, k := range parseCheckKeys(opts.CheckHashFieldKeys) {
+		k.hashFields = true
+		keys = addCheckKey(keys, k)
+	}
+	for _, k := range strings.Split(opts.CheckGeoKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		pair, err := parseGeoCheckKey(k)
+		if err != nil {
+			log.Debugf("Couldn't parse geo key string: %s, err: %s", k, err)
+			continue
+		}
+		keys = addCheckKey(keys, pair)
+	}
+	for _, k := range strings.Split(opts.CheckHashFieldTTLKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		pair, err := parseHashFieldTTLKey(k)
+		if err != nil {
+			log.Debugf("Couldn't parse hash field TTL key string: %s, err: %s", k, err)
+			continue
+		}
+		keys = addCheckKey(keys, pair)
+	}
+	for _, k := range strings.Split(opts.CheckMemberPatternKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		pair, err := parseMemberPatternKey(k)
+		if err != nil {
+			log.Debugf("Couldn't parse member pattern key string: %s, err: %s", k, err)
+			continue
+		}
+		keys = addCheckKey(keys, pair)
+	}
+	return keys
+}
+
+// SetCheckKeys replaces the keys given by Options.CheckKeys, e.g. when they
+// are reloaded from a file. The other key lists of Options are kept. The
+// series of the removed keys are dropped, the remaining keys are exported
+// again by the next scrape.
+func (e *Exporter) SetCheckKeys(checkKeys string) error {
+	if err := ValidateCheckKeys(checkKeys); err != nil {
+		return err
+	}
+	keys := buildCheckKeys(checkKeys, e.opts)
+	e.keysMtx.Lock()
+	e.keys = keys
+	e.keysMtx.Unlock()
+	e.resetKeyMetrics()
+	return nil
+}
+
+// checkKeys returns the keys to check.
+func (e *Exporter) checkKeys() []dbKeyPair {
+	e.keysMtx.RLock()
+	defer e.keysMtx.RUnlock()
+	return e.keys
+}
+
+// parseCheckKeys parses a comma separated list of check-keys entries,
+// invalid entries are skipped.
+func parseCheckKeys(checkKeys string) []dbKeyPair {
+	var keys []dbKeyPair
 	for _, k := range strings.Split(checkKeys, ",") {
-		var err error
-		db := "0"
-		key := ""
-		frags := strings.Split(k, "=")
-		switch len(frags) {
-		case 1:
-			db = "0"
-			key, err = url.QueryUnescape(strings.TrimSpace(frags[0]))
-		case 2:
-			db = strings.Replace(strings.TrimSpace(frags[0]), "db", "", -1)
-			key, err = url.QueryUnescape(strings.TrimSpace(frags[1]))
-		default:
-			err = fmt.Errorf("")
+		if strings.TrimSpace(k) == "" {
+			continue
 		}
+		pair, err := parseCheckKey(k)
 		if err != nil {
-			log.Debugf("Couldn't parse db/key string: %s", k)
+			log.Debugf("Couldn't parse db/key string: %s, err: %s", k, err)
 			continue
 		}
-		if key != "" {
-			e.keys = append(e.keys, dbKeyPair{db, key})
+		keys = append(keys, pair)
+	}
+	return keys
+}
+
+// addCheckKey adds k to keys, merging it into an existing entry for the
+// same address, db and key.
+func addCheckKey(keys []dbKeyPair, k dbKeyPair) []dbKeyPair {
+	for i := range keys {
+		if keys[i].addr == k.addr && keys[i].db == k.db && keys[i].key == k.key {
+			keys[i].bitmap = keys[i].bitmap || k.bitmap
+			keys[i].valueLabel = keys[i].valueLabel || k.valueLabel
+			keys[i].hashFields = keys[i].hashFields || k.hashFields
+			keys[i].geo = keys[i].geo || k.geo
+			if k.radius != nil {
+				keys[i].radius = k.radius
+			}
+			if k.fieldTTL != nil {
+				keys[i].fieldTTL = keys[i].fieldTTL.merge(k.fieldTTL)
+			}
+			if k.memberPatterns != nil {
+				keys[i].memberPatterns = keys[i].memberPatterns.merge(k.memberPatterns)
+			}
+			return keys
 		}
 	}
+	return append(keys, k)
+}
 
-	e.initGauges()
-	return &e, nil
+// checkKeyPrefixRE matches the [<addr>/]db<n>= prefix of a check-keys
+// entry. The address may contain '=' itself, e.g. in query parameters, the
+// db follows the last '/' that is followed by a db.
+var checkKeyPrefixRE = regexp.MustCompile(`^(?:(.*)/)?\s*(?:db)?([0-9]+)\s*=`)
+
+// parseCheckKey parses a single check-keys entry of the form
+// [[<addr>/]db<n>=]<key>, the key may be url encoded. Entries with an
+// address are only checked on the redis node with exactly that address.
+func parseCheckKey(k string) (dbKeyPair, error) {
+	entry := strings.TrimSpace(k)
+	addr, db, key := "", "0", entry
+	if m := checkKeyPrefixRE.FindStringSubmatchIndex(entry); m != nil {
+		if m[2] >= 0 {
+			if addr = strings.TrimSpace(entry[m[2]:m[3]]); addr == "" {
+				return dbKeyPair{}, fmt.Errorf("empty address in %q", k)
+			}
+		}
+		db, key = entry[m[4]:m[5]], entry[m[1]:]
+	} else if strings.Contains(entry, "=") {
+		return dbKeyPair{}, fmt.Errorf("invalid db in %q, expected [[<addr>/]db<n>=]<key>", k)
+	}
+	if strings.Contains(key, "=") {
+		return dbKeyPair{}, fmt.Errorf("too many '=' in %q, '=' in keys must be url encoded", k)
+	}
+	key, err := url.QueryUnescape(strings.TrimSpace(key))
+	if err != nil {
+		return dbKeyPair{}, err
+	}
+	if key == "" {
+		return dbKeyPair{}, fmt.Errorf("empty key in %q", k)
+	}
+	return dbKeyPair{addr: addr, db: db, key: key}, nil
+}
+
+// checkedOn returns true if k is to be checked on the redis node addr.
+func (k dbKeyPair) checkedOn(addr string) bool {
+	return k.addr == "" || k.addr == addr
+}
+
+// ValidateCheckKeys returns an error describing the first malformed entry
+// of a comma separated check-keys list.
+func ValidateCheckKeys(checkKeys string) error {
+	for idx, k := range strings.Split(checkKeys, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		if _, err := parseCheckKey(k); err != nil {
+			return fmt.Errorf("entry %d: %s", idx, err)
+		}
+	}
+	return nil
+}
+
+// ValidateAddr returns an error if addr isn't a redis address the exporter
+// can connect to, e.g. redis://host:port, rediss://host:port, unix:///path or host:port.
+func ValidateAddr(addr string) error {
+	if !strings.Contains(addr, "://") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %s", addr, err)
+		}
+		return nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %s", addr, err)
+	}
+	switch u.Scheme {
+	case "redis", "rediss", "tcp":
+		if u.Host == "" {
+			return fmt.Errorf("invalid address %q: missing host", addr)
+		}
+		if _, err := parseRedisURL(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %s", addr, err)
+		}
+	case "unix":
+		if u.Path == "" {
+			return fmt.Errorf("invalid address %q: missing socket path", addr)
+		}
+	default:
+		return fmt.Errorf("invalid address %q: unsupported scheme %q", addr, u.Scheme)
+	}
+	return nil
+}
+
+// dedupeRedisHost drops repeated addresses from host, keeping the first
+// occurrence and its password, so the same instance isn't scraped twice.
+func dedupeRedisHost(host RedisHost) RedisHost {
+	res := RedisHost{}
+	seen := map[string]bool{}
+	for idx, addr := range host.Addrs {
+		if seen[addr] {
+			log.Warnf("Duplicate redis address %s, ignoring", LabelAddr(addr))
+			continue
+		}
+		seen[addr] = true
+		res.Addrs = append(res.Addrs, addr)
+		if len(host.Passwords) > idx {
+			res.Passwords = append(res.Passwords, host.Passwords[idx])
+		}
+	}
+	return res
 }
 
 // Describe outputs Redis metric descriptions.
@@ -201,27 +736,29 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.metrics {
 		m.Describe(ch)
 	}
-	e.keySizes.Describe(ch)
-	e.keyValues.Describe(ch)
+	e.keyMetrics.describe(ch)
 
 	ch <- e.duration.Desc()
 	ch <- e.totalScrapes.Desc()
 	ch <- e.scrapeErrors.Desc()
+	e.telemetry.describe(ch)
 }
 
 // Collect fetches new metrics from the RedisHost and updates the appropriate metrics.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	scrapes := make(chan scrapeResult)
 
+	// scrape before taking the lock so concurrent Collect calls can share
+	// the redis queries, see scrapeRedisHostShared()
+	go e.scrape(scrapes)
+
 	e.Lock()
 	defer e.Unlock()
 
 	e.initGauges()
-	go e.scrape(scrapes)
 	e.setMetrics(scrapes)
 
-	e.keySizes.Collect(ch)
-	e.keyValues.Collect(ch)
+	e.collectNamespaced(ch)
 
 	ch <- e.duration
 	ch <- e.totalScrapes
@@ -235,7 +772,7 @@ func includeMetric(s string) bool {
 		return true
 	}
 
-	_, ok := metricMap[s]
+	_, ok := infoFields[s]
 
 	return ok
 }
@@ -288,25 +825,155 @@ func parseDBKeyspaceString(db string, stats string) (keysTotal float64, keysExpi
 	return
 }
 
+// keyspaceTotals sums up the keyspace stats of several databases.
+type keyspaceTotals struct {
+	dbs         int
+	keys        float64
+	expiring    float64
+	ttlWeighted float64
+	ttlKeys     float64
+}
+
+func (t *keyspaceTotals) add(keys, expiring, avgTTL float64) {
+	t.dbs++
+	t.keys += keys
+	t.expiring += expiring
+	if avgTTL > -1 {
+		t.ttlWeighted += avgTTL * expiring
+		t.ttlKeys += expiring
+	}
+}
+
+// avgTTL returns the average TTL across all added databases, weighted by
+// their number of expiring keys.
+func (t *keyspaceTotals) avgTTL() (float64, bool) {
+	if t.ttlKeys == 0 {
+		return 0, false
+	}
+	return t.ttlWeighted / t.ttlKeys, true
+}
+
+// aggregateDB returns true if the keyspace stats of db ("db<n>") should be
+// summed up as db="other"
+func aggregateDB(db string, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	idx, err := strconv.Atoi(strings.TrimPrefix(db, "db"))
+	return err == nil && idx >= threshold
+}
+
 func (e *Exporter) extractInfoMetrics(info, addr string, scrapes chan<- scrapeResult) error {
+	return e.extractInfoMetricsTraced(info, addr, scrapes, nil)
+}
+
+// infoTracer is told what happened to every line of an INFO response.
+type infoTracer func(line, action string)
+
+// extractInfoMetricsTraced is extractInfoMetrics, additionally calling trace
+// (if it's not nil) for each line with what the line was mapped to.
+func (e *Exporter) extractInfoMetricsTraced(info, addr string, scrapes chan<- scrapeResult, trace infoTracer) error {
+	if trace == nil {
+		trace = func(string, string) {}
+	}
+
 	cmdstats := false
+	latencystats := false
+	errorstats := false
+	var cmdStats []commandStat
+	other := keyspaceTotals{}
+	memory := memoryUsage{}
+	// failed counts a line of section that couldn't be parsed
+	failed := func(section, line, reason string) {
+		e.telemetryOf(addr).parseFailures.WithLabelValues(LabelAddr(addr), section).Inc()
+		trace(line, reason)
+	}
 	lines := strings.Split(info, "\r\n")
 	for _, line := range lines {
 		log.Debugf("info: %s", line)
 		if len(line) > 0 && line[0] == '#' {
-			if strings.Contains(line, "Commandstats") {
-				cmdstats = true
-			}
+			cmdstats = strings.Contains(line, "Commandstats")
+			latencystats = strings.Contains(line, "Latencystats")
+			errorstats = strings.Contains(line, "Errorstats")
+			trace(line, "section")
 			continue
 		}
 
 		if (len(line) < 2) || (!strings.Contains(line, ":")) {
 			cmdstats = false
+			if len(line) > 0 {
+				trace(line, "skipped, not a field")
+			}
 			continue
 		}
 
 		split := strings.Split(line, ":")
-		if len(split) != 2 || !includeMetric(split[0]) {
+		if len(split) != 2 {
+			if includeMetric(split[0]) {
+				failed(parseSectionOf(split[0]), line, "skipped, unexpected format")
+				continue
+			}
+			trace(line, "skipped, unexpected format")
+			continue
+		}
+		if kind, msgType, ok := parseClusterMessagesField(split[0]); ok {
+			val, err := strconv.ParseFloat(split[1], 64)
+			if err != nil {
+				failed(parseSectionInfo, line, "skipped, couldn't parse value")
+				continue
+			}
+			name := "cluster_messages_" + kind + "_by_type_total"
+			scrapes <- scrapeResult{Name: name, Addr: addr, Value: val, Labels: map[string]string{"type": msgType}}
+			trace(line, fmt.Sprintf("kept as %s{type=%q}", name, msgType))
+			continue
+		}
+
+		if split[0] == "role" {
+			isMaster := 0.0
+			if split[1] == "master" {
+				isMaster = 1
+			}
+			scrapes <- scrapeResult{Name: "replication_is_master", Addr: addr, Value: isMaster}
+			trace(line, "kept as replication_is_master")
+			continue
+		}
+		if latencystats {
+			cmd, quantiles, ok := parseLatencyStats(split[0], split[1])
+			if !ok {
+				failed(parseSectionLatencyStats, line, "skipped, unexpected latency stats format")
+				continue
+			}
+			for q, val := range quantiles {
+				scrapes <- scrapeResult{Name: "command_latency_seconds", Addr: addr, Cmd: cmd, Value: val, Labels: map[string]string{"quantile": q}}
+			}
+			trace(line, fmt.Sprintf("kept as command_latency_seconds{cmd=%q}", cmd))
+			continue
+		}
+		if errorstats {
+			prefix, count, ok := parseErrorStats(split[0], split[1])
+			if !ok {
+				failed(parseSectionErrorStats, line, "skipped, unexpected error stats format")
+				continue
+			}
+			scrapes <- scrapeResult{Name: "errors_total", Addr: addr, Value: count, Labels: map[string]string{"err": prefix}}
+			trace(line, fmt.Sprintf("kept as errors_total{err=%q}", prefix))
+			continue
+		}
+
+		// maxmemory isn't exported on its own, see infoFields
+		if val, err := strconv.ParseFloat(split[1], 64); err == nil {
+			memory.add(split[0], val)
+		}
+		if !includeMetric(split[0]) {
+			if e.opts.DiscoverInfoFields {
+				if val, err := strconv.ParseFloat(split[1], 64); err == nil {
+					name := discoveredFieldName(split[0])
+					scrapes <- scrapeResult{Name: name, Addr: addr, Value: val}
+					trace(line, "discovered as "+name)
+					continue
+				}
+			}
+			trace(line, "skipped, not exported")
 			continue
 		}
 
@@ -315,16 +982,18 @@ func (e *Exporter) extractInfoMetrics(info, addr string, scrapes chan<- scrapeRe
 				cmdstat_get:calls=21,usec=175,usec_per_call=8.33
 				cmdstat_set:calls=61,usec=3139,usec_per_call=51.46
 				cmdstat_setex:calls=75,usec=1260,usec_per_call=16.80
+				cmdstat_get:calls=21,usec=175,usec_per_call=8.33,rejected_calls=0,failed_calls=1 (6.2 and newer)
 			*/
-			frags := strings.Split(split[0], "_")
-			if len(frags) != 2 {
+			// module commands may contain underscores, e.g. cmdstat_ft._list
+			cmd := strings.TrimPrefix(split[0], "cmdstat_")
+			if cmd == "" || cmd == split[0] {
+				failed(parseSectionCommandStats, line, "skipped, unexpected command name")
 				continue
 			}
 
-			cmd := frags[1]
-
-			frags = strings.Split(split[1], ",")
-			if len(frags) != 3 {
+			frags := strings.Split(split[1], ",")
+			if len(frags) < 3 {
+				failed(parseSectionCommandStats, line, "skipped, unexpected command stats format")
 				continue
 			}
 
@@ -332,31 +1001,53 @@ func (e *Exporter) extractInfoMetrics(info, addr string, scrapes chan<- scrapeRe
 			var usecTotal float64
 			var err error
 			if calls, err = extractVal(frags[0]); err != nil {
+				failed(parseSectionCommandStats, line, "skipped, couldn't parse calls")
 				continue
 			}
 			if usecTotal, err = extractVal(frags[1]); err != nil {
+				failed(parseSectionCommandStats, line, "skipped, couldn't parse usec")
 				continue
 			}
 
-			e.metricsMtx.RLock()
-			e.metrics["command_call_duration_seconds_count"].WithLabelValues(addr, cmd).Set(calls)
-			e.metrics["command_call_duration_seconds_sum"].WithLabelValues(addr, cmd).Set(usecTotal / 1e6)
-			e.metricsMtx.RUnlock()
+			if e.opts.CommandStatsTopN > 0 || len(e.opts.CommandStatsCommands) > 0 {
+				cmdStats = append(cmdStats, commandStat{cmd: cmd, calls: calls, usec: usecTotal})
+				trace(line, "kept for aggregated command stats")
+				continue
+			}
+			scrapes <- scrapeResult{Name: "command_call_duration_seconds_count", Addr: addr, Cmd: cmd, Value: calls}
+			scrapes <- scrapeResult{Name: "command_call_duration_seconds_sum", Addr: addr, Cmd: cmd, Value: usecTotal / 1e6}
+			for _, frag := range frags[3:] {
+				if val, err := extractVal(frag); err == nil && (strings.HasPrefix(frag, "rejected_calls=") || strings.HasPrefix(frag, "failed_calls=")) {
+					name := "commands_" + strings.SplitN(frag, "=", 2)[0] + "_total"
+					scrapes <- scrapeResult{Name: name, Addr: addr, Cmd: cmd, Value: val}
+				}
+			}
+			trace(line, fmt.Sprintf("kept as command_call_duration_seconds_count/_sum{cmd=%q}", cmd))
 			continue
 		}
 
 		if keysTotal, keysEx, avgTTL, ok := parseDBKeyspaceString(split[0], split[1]); ok {
+			if aggregateDB(split[0], e.opts.DBAggregateThreshold) {
+				other.add(keysTotal, keysEx, avgTTL)
+				trace(line, `summed up as db="other"`)
+				continue
+			}
 			scrapes <- scrapeResult{Name: "db_keys", Addr: addr, DB: split[0], Value: keysTotal}
 			scrapes <- scrapeResult{Name: "db_keys_expiring", Addr: addr, DB: split[0], Value: keysEx}
 			if avgTTL > -1 {
 				scrapes <- scrapeResult{Name: "db_avg_ttl_seconds", Addr: addr, DB: split[0], Value: avgTTL}
 			}
+			trace(line, fmt.Sprintf("kept as db_keys/db_keys_expiring/db_avg_ttl_seconds{db=%q}", split[0]))
 			continue
 		}
 
 		metricName := split[0]
-		if newName, ok := metricMap[metricName]; ok {
-			metricName = newName
+		action := "kept as " + metricName
+		if d, ok := infoFields[metricName]; ok {
+			if d.name != metricName {
+				action = "renamed to " + d.name
+			}
+			metricName = d.name
 		}
 
 		var err error
@@ -376,14 +1067,35 @@ func (e *Exporter) extractInfoMetrics(info, addr string, scrapes chan<- scrapeRe
 		}
 		if err != nil {
 			log.Debugf("couldn't parse %s, err: %s", split[1], err)
+			failed(parseSectionOf(split[0]), line, "skipped, couldn't parse value")
 			continue
 		}
 
 		scrapes <- scrapeResult{Name: metricName, Addr: addr, Value: val}
+		trace(line, action)
+	}
+
+	if other.dbs > 0 {
+		scrapes <- scrapeResult{Name: "db_keys", Addr: addr, DB: "other", Value: other.keys}
+		scrapes <- scrapeResult{Name: "db_keys_expiring", Addr: addr, DB: "other", Value: other.expiring}
+		if avgTTL, ok := other.avgTTL(); ok {
+			scrapes <- scrapeResult{Name: "db_avg_ttl_seconds", Addr: addr, DB: "other", Value: avgTTL}
+		}
+	}
+
+	if pct, ok := memory.percent(); ok {
+		scrapes <- scrapeResult{Name: "memory_used_percent", Addr: addr, Value: pct}
+	}
+
+	for _, st := range selectCommandStats(cmdStats, e.opts.CommandStatsCommands, e.opts.CommandStatsTopN) {
+		scrapes <- scrapeResult{Name: "command_call_duration_seconds_count", Addr: addr, Cmd: st.cmd, Value: st.calls}
+		scrapes <- scrapeResult{Name: "command_call_duration_seconds_sum", Addr: addr, Cmd: st.cmd, Value: st.usec / 1e6}
 	}
 	return nil
 }
 
+// extractConfigMetrics sends the numeric values of a CONFIG GET reply as
+// config_<name>, dashes in the name replaced by underscores.
 func extractConfigMetrics(config []string, addr string, scrapes chan<- scrapeResult) error {
 
 	if len(config)%2 != 0 {
@@ -396,127 +1108,520 @@ func extractConfigMetrics(config []string, addr string, scrapes chan<- scrapeRes
 			log.Debugf("couldn't parse %s, err: %s", config[pos*2+1], err)
 			continue
 		}
-		scrapes <- scrapeResult{Name: fmt.Sprintf("config_%s", config[pos*2]), Addr: addr, Value: val}
+		name := strings.Replace(config[pos*2], "-", "_", -1)
+		scrapes <- scrapeResult{Name: fmt.Sprintf("config_%s", name), Addr: addr, Value: val}
 	}
 	return nil
 }
 
+// scrape queries all configured hosts and sends the results on scrapes,
+// closing it when done. Results are never dropped, so the caller must keep
+// draining scrapes concurrently (see setMetrics) until it is closed.
 func (e *Exporter) scrape(scrapes chan<- scrapeResult) {
 
 	defer close(scrapes)
 	now := time.Now().UnixNano()
 	e.totalScrapes.Inc()
 
-	errorCount := 0
-	for idx, addr := range e.redis.Addrs {
-		var c redis.Conn
-		var err error
+	e.progress.start()
+	defer e.progress.done()
+
+	span := e.opts.Tracer.startSpan("scrape", nil)
+	span.setAttr("redis.targets", strconv.Itoa(len(e.redis.Addrs)))
+	defer span.finish()
 
-		scrapes <- scrapeResult{Name: "up", Addr: addr, Value: 0}
+	var errorCount int32
+	var wg sync.WaitGroup
+	clusterTotals := newClusterKeyspace()
+	if e.opts.Failover {
+		if err := e.scrapeFailover(scrapes, clusterTotals, span); err != nil {
+			errorCount = 1
+		}
+	} else {
+		for idx, addr := range e.redis.Addrs {
+			wg.Add(1)
+			go func(idx int, addr string) {
+				defer wg.Done()
+				results, err := e.scrapeTarget(idx, addr, span)
+				e.sendResults(results, scrapes, clusterTotals)
+				if err != nil {
+					atomic.AddInt32(&errorCount, 1)
+					return
+				}
+				if e.opts.DiscoverReplicas {
+					e.scrapeReplicas(idx, addr, scrapes, clusterTotals, span)
+				}
+			}(idx, addr)
+		}
+	}
+	wg.Wait()
 
-		var options []redis.DialOption
-		if len(e.redis.Passwords) > idx && e.redis.Passwords[idx] != "" {
-			options = append(options, redis.DialPassword(e.redis.Passwords[idx]))
+	if e.opts.ClusterKeyspaceTotals {
+		for _, scr := range clusterTotals.results() {
+			scrapes <- scr
 		}
+	}
 
-		log.Debugf("Trying DialURL(): %s", addr)
-		if c, err = redis.DialURL(addr, options...); err != nil {
-			log.Debugf("DialURL() failed, err: %s", err)
-			frags := strings.Split(addr, "://")
-			if len(frags) == 2 {
-				log.Debugf("Trying: Dial(): %s %s", frags[0], frags[1])
-				c, err = redis.Dial(frags[0], frags[1], options...)
-			} else {
-				log.Debugf("Trying: Dial(): tcp %s", addr)
-				c, err = redis.Dial("tcp", addr, options...)
+	e.scrapeErrors.Set(float64(errorCount))
+	e.duration.Set(float64(time.Now().UnixNano()-now) / 1000000000)
+	log.WithFields(log.Fields{"targets": len(e.redis.Addrs), "errors": errorCount, "duration": float64(time.Now().UnixNano()-now) / 1000000000}).Debug("scrape of all targets done")
+}
+
+// scrapeTarget scrapes the host addr, logging the outcome, span is the span
+// of the scrape if it's traced.
+func (e *Exporter) scrapeTarget(idx int, addr string, span *Span) ([]scrapeResult, error) {
+	e.telemetryOf(addr).goroutines.Inc()
+	defer e.telemetryOf(addr).goroutines.Dec()
+
+	start := time.Now()
+	results, err := e.scrapeRedisHostShared(idx, addr, span)
+	// the results may be cached or shared with a concurrent scrape, their
+	// deltas are the increase since the results served last
+	results = e.withDeltas(addr, results)
+	results = e.guardSeries(addr, results)
+	results = e.withNamespace(addr, results)
+	e.statuses.set(addr, start, results, err)
+	entry := log.WithFields(log.Fields{"target": LabelAddr(addr), "duration": time.Since(start).Seconds()})
+	if err != nil {
+		entry.WithError(err).Error("scrape failed")
+	} else {
+		entry.Debug("scrape done")
+	}
+	return results, err
+}
+
+// sendResults sends the results of a single host on scrapes.
+func (e *Exporter) sendResults(results []scrapeResult, scrapes chan<- scrapeResult, clusterTotals *clusterKeyspace) {
+	for _, scr := range results {
+		scrapes <- scr
+	}
+	if e.opts.ClusterKeyspaceTotals {
+		clusterTotals.add(results)
+	}
+}
+
+// scrapeFailover treats the configured hosts as a prioritized list of
+// addresses of a single instance and scrapes the first reachable one.
+// failover_index tells which one it was, the results of unreachable hosts
+// are only sent if all of them failed.
+func (e *Exporter) scrapeFailover(scrapes chan<- scrapeResult, clusterTotals *clusterKeyspace, span *Span) error {
+	var err error
+	var results []scrapeResult
+	for idx, addr := range e.redis.Addrs {
+		if results, err = e.scrapeTarget(idx, addr, span); err == nil {
+			e.sendResults(results, scrapes, clusterTotals)
+			scrapes <- scrapeResult{Name: "failover_index", Value: float64(idx)}
+			return nil
+		}
+	}
+	e.sendResults(results, scrapes, clusterTotals)
+	scrapes <- scrapeResult{Name: "failover_index", Value: -1}
+	return err
+}
+
+// scrapeRedisHostShared scrapes a single host, sharing the results with any
+// concurrent scrape of the same host. Results younger than the cache TTL are
+// served without querying redis at all.
+func (e *Exporter) scrapeRedisHostShared(idx int, addr string, span *Span) ([]scrapeResult, error) {
+	if cached, ok := e.cache.get(addr, e.cacheTTL); ok {
+		log.WithField("target", LabelAddr(addr)).Debug("serving cached results")
+		return cached.results, cached.err
+	}
+	return e.refreshHost(idx, addr, span)
+}
+
+// refreshHost scrapes a single host, sharing the results with any concurrent
+// scrape of the same host, and caches them. The scrape is traced below
+// parent, or as a trace of its own if parent is nil. Only the scrape itself
+// counts against the concurrency limit, not waiting for a shared one or
+// serving cached results.
+func (e *Exporter) refreshHost(idx int, addr string, parent *Span) ([]scrapeResult, error) {
+	return e.flights.do(addr, func() ([]scrapeResult, error) {
+		e.limiter.acquire()
+		defer e.limiter.release()
+
+		hostScrapes := make(chan scrapeResult)
+		done := make(chan struct{})
+		results := []scrapeResult{}
+		go func() {
+			for scr := range hostScrapes {
+				results = append(results, scr)
 			}
+			close(done)
+		}()
+
+		span := e.opts.Tracer.startSpan("scrape "+LabelAddr(addr), parent)
+		span.setAttr("redis.target", LabelAddr(addr))
+		var t *phaseTimer
+		if span != nil {
+			t = &phaseTimer{span: span}
+		}
+
+		start := time.Now()
+		err := e.scrapeRedisHostRecovered(idx, addr, hostScrapes, t)
+		close(hostScrapes)
+		span.setError(err)
+		span.finish()
+		<-done
+		reset := e.watchdog.record(addr, err, e.opts.ResetAfterFailures)
+		if reset {
+			e.resetTarget(addr, e.opts.ResetAfterFailures)
 		}
+		// deltas are computed per served scrape, see scrapeTarget
+		results = e.withRates(addr, start, results)
+		// the results of a reset target aren't cached, so its next scrape
+		// queries it right away
+		if e.cacheTTL > 0 && !reset {
+			e.cache.set(addr, results, err)
+		}
+		return results, err
+	})
+}
 
+// connectToRedis dials the redis node addr, idx is the position of addr in the
+// configured hosts and is used to look up its password, -1 means no password.
+// Credentials in the user info of addr take precedence over the password.
+func (e *Exporter) connectToRedis(idx int, addr string) (redis.Conn, error) {
+	return e.connectToRedisTimed(idx, addr, nil)
+}
+
+// connectToRedisTimed is connectToRedis, timing the dial and the setup of
+// the connection (AUTH, SELECT, ...) with t.
+func (e *Exporter) connectToRedisTimed(idx int, addr string, t *phaseTimer) (redis.Conn, error) {
+	var c redis.Conn
+	var err error
+
+	u, err := parseRedisURL(addr)
+	if err != nil {
+		e.telemetryOf(addr).connFailed(addr)
+		return nil, fmt.Errorf("invalid address %q: %s", LabelAddr(addr), err)
+	}
+	if !u.auth && idx >= 0 && e.opts.Credentials != nil && len(e.redis.Addrs) > idx {
+		user, password, err := e.opts.Credentials.Credentials(e.redis.Addrs[idx])
 		if err != nil {
-			log.Printf("redis err: %s", err)
-			errorCount++
-			continue
+			e.telemetryOf(addr).connFailed(addr)
+			return nil, fmt.Errorf("couldn't get credentials: %s", err)
+		}
+		u.user, u.password, u.auth = user, password, password != ""
+	}
+	if !u.auth && idx >= 0 && len(e.redis.Passwords) > idx && e.redis.Passwords[idx] != "" {
+		u.password, u.auth = e.redis.Passwords[idx], true
+	}
+
+	var options []redis.DialOption
+	if e.tlsConfig != nil {
+		options = append(options, redis.DialTLSConfig(e.tlsConfig))
+	}
+	dialer, commandTimeout := e.opts.Dialer, e.opts.CommandTimeout
+	if t, ok := e.opts.TargetTimeouts[addr]; ok {
+		if t.Connect > 0 {
+			d := net.Dialer{}
+			if dialer != nil {
+				d = *dialer
+			}
+			d.Timeout = t.Connect
+			dialer = &d
 		}
-		defer c.Close()
-		log.Debugf("connected to: %s", addr)
+		if t.Command > 0 {
+			commandTimeout = t.Command
+		}
+	}
+	if d := u.dialer(dialer); len(e.opts.DialHosts) > 0 {
+		options = append(options, redis.DialNetDial(pinnedDial(d, e.opts.DialHosts)))
+	} else if d != nil {
+		options = append(options, redis.DialNetDial(d.Dial))
+	}
+	if commandTimeout > 0 {
+		options = append(options, redis.DialReadTimeout(commandTimeout), redis.DialWriteTimeout(commandTimeout))
+	}
 
-		info, err := redis.String(c.Do("INFO", "ALL"))
-		if err == nil {
-			err = e.extractInfoMetrics(info, addr, scrapes)
+	dialStart := time.Now()
+	log.Debugf("Trying DialURL(): %s", u.dial)
+	if c, err = redis.DialURL(u.dial, options...); err != nil {
+		log.Debugf("DialURL() failed, err: %s", err)
+		frags := strings.Split(u.dial, "://")
+		if len(frags) == 2 {
+			log.Debugf("Trying: Dial(): %s %s", frags[0], frags[1])
+			c, err = redis.Dial(frags[0], frags[1], options...)
 		} else {
-			log.Printf("redis err: %s", err)
-			errorCount++
-			continue
+			log.Debugf("Trying: Dial(): tcp %s", u.dial)
+			c, err = redis.Dial("tcp", u.dial, options...)
+		}
+	}
+	t.since(phaseDial, dialStart)
+	if err == nil {
+		setupStart := time.Now()
+		if err = u.setup(c); err != nil {
+			c.Close()
 		}
+		t.since(phaseAuth, setupStart)
+	}
+	if err != nil {
+		e.telemetryOf(addr).connFailed(addr)
+		return nil, err
+	}
+	return e.telemetryOf(addr).connOpened(addr, c), nil
+}
 
-		if strings.Index(info, "cluster_enabled:1") != -1 {
-			info, err = redis.String(c.Do("CLUSTER", "INFO"))
-			if err == nil {
-				err = e.extractInfoMetrics(info, addr, scrapes)
-			} else {
-				log.Printf("redis err: %s", err)
-				errorCount++
-				continue
-			}
+// scrapeRedisHostRecovered scrapes a single host like scrapeRedisHost, but
+// turns a panic, e.g. of the parser on a malformed INFO response, into a
+// scrape error so the other hosts are still scraped.
+func (e *Exporter) scrapeRedisHostRecovered(idx int, addr string, scrapes chan<- scrapeResult, t *phaseTimer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.telemetryOf(addr).scrapePanics.WithLabelValues(LabelAddr(addr)).Inc()
+			log.WithField("target", LabelAddr(addr)).Errorf("scrape panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("scrape panicked: %v", r)
 		}
+	}()
+	return e.scrapeRedisHost(idx, addr, scrapes, t)
+}
+
+// scrapeRedisHost scrapes a single host, timing (and tracing) its phases with
+// t unless it's nil.
+func (e *Exporter) scrapeRedisHost(idx int, addr string, scrapes chan<- scrapeResult, t *phaseTimer) error {
+	if e.opts.Replay {
+		return e.replayRedisHost(addr, scrapes)
+	}
+	scrapes <- scrapeResult{Name: "up", Addr: addr, Value: 0}
 
-		scrapes <- scrapeResult{Name: "up", Addr: addr, Value: 1}
+	c, err := e.connectToRedisTimed(idx, addr, t)
+	if err != nil {
+		return err
+	}
+	c = traceConn(c, t.traceSpan())
+	defer c.Close()
+	log.Debugf("connected to: %s", LabelAddr(addr))
+
+	if e.opts.MinimalTargets[addr] {
+		return pingRedisHost(c, addr, scrapes)
+	}
+
+	start := time.Now()
+	info, err := e.fetchInfo(c, addr)
+	t.since(phaseInfo, start)
+	if err != nil {
+		return err
+	}
+	e.telemetryOf(addr).infoBytes.Add(float64(len(info)))
+	e.extractInfoTimed(info, addr, scrapes, t)
+	f := featuresOf(info)
+	e.nodeFeatures.set(addr, f)
 
-		if config, err := redis.Strings(c.Do("CONFIG", "GET", "maxmemory")); err == nil {
-			extractConfigMetrics(config, addr, scrapes)
+	if e.opts.DiscoverReplicas && strings.Contains(info, "role:master") {
+		e.replicas.set(addr, parseReplicas(info, addr))
+	}
+
+	isCluster := strings.Contains(info, "cluster_enabled:1")
+	if isCluster {
+		start := time.Now()
+		clusterInfo, err := redis.String(c.Do("CLUSTER", "INFO"))
+		t.since(phaseCluster, start)
+		if err != nil {
+			return err
 		}
+		e.telemetryOf(addr).infoBytes.Add(float64(len(clusterInfo)))
+		e.extractInfoTimed(clusterInfo, addr, scrapes, t)
+	}
+
+	scrapes <- scrapeResult{Name: "up", Addr: addr, Value: 1}
+
+	if isSentinel(info) {
+		// sentinels have neither keys nor a maxmemory setting
+		scrapeSentinelMasters(c, info, addr, scrapes)
+		return nil
+	}
+
+	if e.section("config") {
+		start := time.Now()
+		scrapeConfig(c, addr, isCluster, e.opts.Pipeline, scrapes)
+		t.since(phaseConfig, start)
+	}
+
+	// the key checks and SCANs are expensive, they may be cached longer than
+	// the rest of the scrape
+	cachedKeys, keysCached := e.keyCache.get(addr, e.opts.KeyCacheTTL)
+	checkKeys := e.section("keys") && !keysCached
 
-		for _, k := range e.keys {
-			if _, err := c.Do("SELECT", k.db); err != nil {
+	nodes := clusterNodes{}
+	if isCluster {
+		start := time.Now()
+		nodesInfo, err := redis.String(c.Do("CLUSTER", "NODES"))
+		if err != nil {
+			log.WithField("target", LabelAddr(addr)).WithError(err).Debug("CLUSTER NODES failed")
+		}
+		nodes = parseClusterNodes(nodesInfo)
+		if e.opts.ClusterSlotSamples > 0 && err == nil {
+			e.slots.sample(c, addr, nodes, e.opts.ClusterSlotSamples, scrapes)
+		}
+		t.since(phaseCluster, start)
+		if checkKeys {
+			start := time.Now()
+			e.checkClusterKeys(c, idx, addr, f, nodes)
+			t.since(phaseKeys, start)
+		}
+	} else if checkKeys {
+		start := time.Now()
+		var keys []dbKeyPair
+		for _, k := range e.checkKeys() {
+			if !k.checkedOn(addr) {
 				continue
 			}
-			if tempVal, err := c.Do("GET", k.key); err == nil && tempVal != nil {
-				if val, err := strconv.ParseFloat(fmt.Sprintf("%s", tempVal), 64); err == nil {
-					e.keyValues.WithLabelValues("db"+k.db, k.key).Set(val)
-				}
+			if e.isGlob(k.key) {
+				e.checkGlobKey(c, addr, f, k)
+				continue
 			}
+			keys = append(keys, k)
+		}
+		e.checkKeyList(nil, c, addr, f, keys)
+		t.since(phaseKeys, start)
+	}
 
-			for _, op := range []string{
-				"HLEN",
-				"LLEN",
-				"SCARD",
-				"ZCARD",
-				"PFCOUNT",
-				"STRLEN",
-			} {
-				if tempVal, err := c.Do(op, k.key); err == nil && tempVal != nil {
-					e.keySizes.WithLabelValues("db"+k.db, k.key).Set(float64(tempVal.(int64)))
-					break
-				}
-			}
+	if e.opts.Leader != nil && !e.opts.Leader() {
+		if checkKeys && e.opts.KeyCacheTTL > 0 {
+			e.keyCache.set(addr, nil, nil)
 		}
+		return nil
 	}
 
-	e.scrapeErrors.Set(float64(errorCount))
-	e.duration.Set(float64(time.Now().UnixNano()-now) / 1000000000)
+	if keysCached && e.section("keys") {
+		for _, scr := range cachedKeys.results {
+			scrapes <- scr
+		}
+	} else if checkKeys {
+		start := time.Now()
+		e.scanKeys(c, addr, f, scrapes)
+		t.since(phaseKeys, start)
+	}
+	if len(e.opts.Sections) > 0 {
+		// the WAIT probe and MONITOR sampling only run on full scrapes
+		return nil
+	}
+
+	if e.opts.WaitProbeReplicas > 0 && f.wait && strings.Contains(info, "role:master") {
+		start := time.Now()
+		e.probeWait(c, addr, nodes, scrapes)
+		t.since(phaseWait, start)
+	}
+
+	if e.opts.MonitorSampleDuration > 0 {
+		start := time.Now()
+		e.sampleMonitor(idx, addr, scrapes)
+		t.since(phaseMonitor, start)
+	}
+	return nil
+}
+
+// pingRedisHost scrapes a node in minimal mode: it's up if it answers PING,
+// the round trip time of which is exported as well.
+func pingRedisHost(c redis.Conn, addr string, scrapes chan<- scrapeResult) error {
+	start := time.Now()
+	if _, err := c.Do("PING"); err != nil {
+		return err
+	}
+	scrapes <- scrapeResult{Name: "ping_duration_seconds", Addr: addr, Value: time.Since(start).Seconds()}
+	scrapes <- scrapeResult{Name: "up", Addr: addr, Value: 1}
+	return nil
+}
+
+// scanKeys runs the key group and keyspace sample SCANs of addr, keeping
+// their results in the key cache if Options.KeyCacheTTL is set.
+func (e *Exporter) scanKeys(c redis.Conn, addr string, f features, scrapes chan<- scrapeResult) {
+	scan := func(scrapes chan<- scrapeResult) {
+		if len(e.keyGroups) > 0 {
+			e.countKeyGroups(c, addr, f, scrapes)
+		}
+		if len(e.keyspaceDBs) > 0 {
+			e.sampleKeyspace(c, addr, f, scrapes)
+		}
+	}
+	if e.opts.KeyCacheTTL <= 0 {
+		scan(scrapes)
+		return
+	}
+
+	keyScrapes := make(chan scrapeResult)
+	go func() {
+		scan(keyScrapes)
+		close(keyScrapes)
+	}()
+	var results []scrapeResult
+	for scr := range keyScrapes {
+		results = append(results, scr)
+		scrapes <- scr
+	}
+	e.keyCache.set(addr, results, nil)
+}
+
+// labels returns the prometheus labels of scr, the values are sanitized.
+func (scr scrapeResult) labels() prometheus.Labels {
+	var labels prometheus.Labels = map[string]string{}
+	if len(scr.Addr) > 0 {
+		labels["addr"] = LabelAddr(scr.Addr)
+	}
+	if len(scr.DB) > 0 {
+		labels["db"] = scr.DB
+	}
+	if len(scr.Cmd) > 0 {
+		labels["cmd"] = scr.Cmd
+	}
+	for k, v := range scr.Labels {
+		labels[k] = v
+	}
+	for k, v := range labels {
+		labels[k] = sanitizeLabelValue(v)
+	}
+	return labels
 }
 
 func (e *Exporter) setMetrics(scrapes <-chan scrapeResult) {
 	for scr := range scrapes {
-		name := scr.Name
-		if _, ok := e.metrics[name]; !ok {
-			e.metricsMtx.Lock()
-			e.metrics[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: e.namespace,
-				Name:      name,
-			}, []string{"addr"})
-			e.metricsMtx.Unlock()
+		name := sanitizeMetricName(scr.Name)
+		labels := scr.labels()
+		e.metricsMtx.Lock()
+		metrics := e.metricsOf(scr.Namespace)
+		if _, ok := metrics[name]; !ok {
+			labelNames := []string{}
+			for l := range labels {
+				labelNames = append(labelNames, l)
+			}
+			sort.Strings(labelNames)
+			if scr.Namespace != "" {
+				metrics[name] = e.newMetricVecIn(scr.Namespace, name, labelNames)
+			} else {
+				metrics[name] = e.newMetricVec(name, labelNames)
+			}
 		}
-		var labels prometheus.Labels = map[string]string{"addr": scr.Addr}
-		if len(scr.DB) > 0 {
-			labels["db"] = scr.DB
+		if _, err := metrics[name].GetMetricWith(labels); err != nil {
+			log.WithError(err).Debugf("inconsistent labels for %s", name)
+		} else {
+			metrics[name].With(labels).Set(float64(scr.Value))
 		}
-		e.metrics[name].With(labels).Set(float64(scr.Value))
+		e.metricsMtx.Unlock()
 	}
 }
 
 func (e *Exporter) collectMetrics(metrics chan<- prometheus.Metric) {
-	for _, m := range e.metrics {
+	e.collectMetricsIn(e.namespace, e.metrics, metrics)
+	for namespace, vecs := range e.nsMetrics {
+		e.collectMetricsIn(namespace, vecs, metrics)
+	}
+}
+
+func (e *Exporter) collectMetricsIn(namespace string, vecs map[string]*prometheus.GaugeVec, metrics chan<- prometheus.Metric) {
+	for name, m := range vecs {
+		if base, ok := histogramOf(name); ok {
+			if name == base+"_bucket" {
+				help := helpText(e.opts, base, describeMetric(base).helpText())
+				collectAsHistograms(m, vecs[base+"_sum"], vecs[base+"_count"], prometheus.BuildFQName(namespace, "", base), help, metrics)
+			}
+			continue
+		}
+		if describeMetric(name).typ == counterMetric && !e.opts.Deltas {
+			help := helpText(e.opts, name, describeMetric(name).helpText())
+			collectAsCounters(m, prometheus.BuildFQName(namespace, "", name), help, metrics)
+			continue
+		}
 		m.Collect(metrics)
 	}
 }
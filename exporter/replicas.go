@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// parseReplicas returns the addresses of the replicas listed in the
+// Replication section of the INFO response of a master, e.g.
+// slave0:ip=10.0.0.2,port=6379,state=online,offset=1234,lag=0
+// The addresses use the scheme and the credentials of the master address
+// addr.
+func parseReplicas(info, addr string) []string {
+	var res []string
+	for _, line := range strings.Split(info, "\r\n") {
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 {
+			continue
+		}
+		// slave<n>, not slave_read_only etc.
+		if n := strings.TrimPrefix(split[0], "slave"); n == split[0] || n == "" || strings.Trim(n, "0123456789") != "" {
+			continue
+		}
+		var ip, port string
+		for _, kv := range strings.Split(split[1], ",") {
+			switch {
+			case strings.HasPrefix(kv, "ip="):
+				ip = strings.TrimPrefix(kv, "ip=")
+			case strings.HasPrefix(kv, "port="):
+				port = strings.TrimPrefix(kv, "port=")
+			}
+		}
+		if ip != "" && port != "" {
+			res = append(res, peerAddr(addr, net.JoinHostPort(ip, port)))
+		}
+	}
+	return res
+}
+
+// replicaSet keeps the replicas last discovered per master.
+type replicaSet struct {
+	mtx      sync.Mutex
+	replicas map[string][]string
+}
+
+func (r *replicaSet) set(master string, replicas []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.replicas == nil {
+		r.replicas = map[string][]string{}
+	}
+	r.replicas[master] = replicas
+}
+
+func (r *replicaSet) get(master string) []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.replicas[master]
+}
+
+// scrapeReplicas scrapes the replicas discovered on master that aren't
+// configured themselves, using the password of master, and sends
+// discovered_replica_info for each of them.
+func (e *Exporter) scrapeReplicas(idx int, master string, scrapes chan<- scrapeResult, clusterTotals *clusterKeyspace, span *Span) {
+	configured := map[string]bool{}
+	for _, a := range e.redis.Addrs {
+		configured[hostPort(a)] = true
+	}
+
+	for _, replica := range e.replicas.get(master) {
+		if configured[hostPort(replica)] {
+			continue
+		}
+		results, _ := e.scrapeTarget(idx, replica, span)
+		e.sendResults(results, scrapes, clusterTotals)
+		scrapes <- scrapeResult{Name: "discovered_replica_info", Addr: replica, Value: 1, Labels: map[string]string{"master": LabelAddr(master)}}
+	}
+}
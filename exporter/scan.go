@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// number of keys requested per SCAN call if Options.ScanCount isn't set
+const defaultScanCount = 1000
+
+var errUnexpectedScanReply = errors.New("unexpected reply to SCAN")
+
+// sizeCommands maps a key type to the command returning its length or size.
+var sizeCommands = map[string]string{
+	"string": "STRLEN",
+	"list":   "LLEN",
+	"set":    "SCARD",
+	"zset":   "ZCARD",
+	"hash":   "HLEN",
+	"stream": "XLEN",
+}
+
+// KeyInfo describes a single key found by ScanKeys.
+type KeyInfo struct {
+	DB   string `json:"db"`
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+
+	// MemoryBytes is only set by AnalyzeKeys
+	MemoryBytes int64 `json:"memory_bytes,omitempty"`
+}
+
+// ScanKeys SCANs db of the redis node addr for keys matching pattern and
+// returns their type and length or size, returning at most limit keys
+// (limit <= 0 returns all matching keys).
+func (e *Exporter) ScanKeys(addr, db, pattern string, limit int) ([]KeyInfo, error) {
+	c, err := e.connectToRedis(e.addrIndex(addr), addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if _, err := c.Do("SELECT", db); err != nil {
+		return nil, err
+	}
+
+	res := []KeyInfo{}
+	err = scanMatching(c, pattern, e.scanCount(), e.opts.ScanThrottle, func(key string) (bool, error) {
+		info := KeyInfo{DB: db, Key: key}
+		var err error
+		if info.Type, err = redis.String(c.Do("TYPE", key)); err != nil {
+			return false, err
+		}
+		if cmd, ok := sizeCommands[info.Type]; ok {
+			info.Size, _ = redis.Int64(c.Do(cmd, key))
+		}
+		res = append(res, info)
+		return limit <= 0 || len(res) < limit, nil
+	})
+	return res, err
+}
+
+// scanCount returns the COUNT hint of SCAN calls.
+func (e *Exporter) scanCount() int {
+	if e.opts.ScanCount > 0 {
+		return e.opts.ScanCount
+	}
+	return defaultScanCount
+}
+
+// scanMatching SCANs the selected db of c for keys matching pattern, count
+// keys per call paced by throttle, and calls fn for each of them, fn returns
+// false or an error to stop early.
+func scanMatching(c redis.Conn, pattern string, count int, throttle *ScanThrottle, fn func(key string) (bool, error)) error {
+	cursor := 0
+	for {
+		next, keys, err := scanPage(c, cursor, pattern, count, throttle)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if more, err := fn(key); err != nil || !more {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// scanChunk SCANs the selected db of c like scanMatching but starting at
+// cursor and only until fn was called for at least limit keys, always for
+// all keys of a SCAN reply. It returns the cursor to resume from, 0 once the
+// whole db was scanned.
+func scanChunk(c redis.Conn, pattern string, count int, throttle *ScanThrottle, cursor, limit int, fn func(key string)) (int, error) {
+	scanned := 0
+	for {
+		next, keys, err := scanPage(c, cursor, pattern, count, throttle)
+		if err != nil {
+			return cursor, err
+		}
+		for _, key := range keys {
+			fn(key)
+		}
+		scanned += len(keys)
+		if cursor = next; cursor == 0 || scanned >= limit {
+			return cursor, nil
+		}
+	}
+}
+
+// scanPage calls SCAN once and returns the next cursor and the keys.
+func scanPage(c redis.Conn, cursor int, pattern string, count int, throttle *ScanThrottle) (int, []string, error) {
+	values, err := redis.Values(c.Do("SCAN", cursor, "MATCH", pattern, "COUNT", count))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(values) != 2 {
+		return 0, nil, errUnexpectedScanReply
+	}
+	if cursor, err = redis.Int(values[0], nil); err != nil {
+		return 0, nil, err
+	}
+	keys, err := redis.Strings(values[1], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	throttle.wait(len(keys))
+	return cursor, keys, nil
+}
+
+// scanState is the progress of a SCAN spread over several scrapes, see
+// Options.ScanChunk.
+type scanState struct {
+	cursor int
+	// counts of the key group SCAN, of the running and the last complete
+	// pass, the latter is nil until the first pass completed
+	keys, memory         map[string]float64
+	lastKeys, lastMemory map[string]float64
+}
+
+// scanStates are the scanStates by node, db and the feature scanning.
+type scanStates struct {
+	mtx    sync.Mutex
+	states map[string]*scanState
+}
+
+// get returns the state of the SCAN of feature of db of addr. Scrapes of a
+// node don't run concurrently, so the state isn't locked.
+func (s *scanStates) get(addr, feature, db string) *scanState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.states == nil {
+		s.states = map[string]*scanState{}
+	}
+	key := addr + "\x00" + feature + "\x00" + db
+	st, ok := s.states[key]
+	if !ok {
+		st = &scanState{}
+		s.states[key] = st
+	}
+	return st
+}
+
+// addrIndex returns the position of addr in the configured hosts, or -1.
+func (e *Exporter) addrIndex(addr string) int {
+	for idx, a := range e.redis.Addrs {
+		if a == addr {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// infoSectionNames are the sections of INFO that can be selected via
+// Options.Sections.
+var infoSectionNames = map[string]bool{
+	"server": true, "clients": true, "memory": true, "persistence": true,
+	"stats": true, "replication": true, "cpu": true, "commandstats": true,
+	"latencystats": true, "errorstats": true, "cluster": true, "keyspace": true,
+	"modules": true,
+}
+
+// collectorSections are the parts of a scrape besides INFO that can be
+// selected via Options.Sections.
+var collectorSections = map[string]bool{
+	"config": true, // CONFIG GET based metrics
+	"keys":   true, // key checks and key groups
+}
+
+// ValidateSections returns an error if sections contains a name that is
+// neither an INFO section nor a collector of Options.Sections.
+func ValidateSections(sections []string) error {
+	for _, s := range sections {
+		if s = strings.ToLower(s); !infoSectionNames[s] && !collectorSections[s] {
+			return fmt.Errorf("unknown section %q", s)
+		}
+	}
+	return nil
+}
+
+// section returns whether the scrape includes the section or collector name.
+func (e *Exporter) section(name string) bool {
+	if len(e.opts.Sections) == 0 {
+		return true
+	}
+	for _, s := range e.opts.Sections {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchInfo returns the INFO response of addr, only the sections of
+// Options.Sections if set. Every section is requested separately since
+// redis before 7.0 only accepts one per INFO call.
+func (e *Exporter) fetchInfo(c redis.Conn, addr string) (string, error) {
+	if len(e.opts.Sections) == 0 {
+		return redis.String(c.Do("INFO", e.infoSection(addr)))
+	}
+	var info []string
+	for _, s := range e.opts.Sections {
+		if !infoSectionNames[strings.ToLower(s)] {
+			continue
+		}
+		i, err := redis.String(c.Do("INFO", s))
+		if err != nil {
+			return "", err
+		}
+		info = append(info, strings.TrimRight(i, "\r\n"))
+	}
+	return strings.Join(info, "\r\n\r\n") + "\r\n", nil
+}
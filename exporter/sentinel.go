@@ -0,0 +1,167 @@
+package exporter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// sentinelMasterFields maps the settings returned by SENTINEL MASTER to the
+// metrics exported for them.
+var sentinelMasterFields = map[string]string{
+	"quorum":                  "sentinel_master_quorum",
+	"parallel-syncs":          "sentinel_master_parallel_syncs",
+	"down-after-milliseconds": "sentinel_master_down_after_milliseconds",
+	"failover-timeout":        "sentinel_master_failover_timeout_milliseconds",
+}
+
+// isSentinel returns true if info is the INFO response of a sentinel.
+func isSentinel(info string) bool {
+	return strings.Contains(info, "redis_mode:sentinel")
+}
+
+// parseSentinelMasterNames returns the names of the masters monitored by a
+// sentinel from the Sentinel section of its INFO response, e.g.
+// master0:name=mymaster,status=ok,address=127.0.0.1:6379,slaves=1,sentinels=3
+func parseSentinelMasterNames(info string) []string {
+	var names []string
+	for _, line := range strings.Split(info, "\r\n") {
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 || !strings.HasPrefix(split[0], "master") {
+			continue
+		}
+		for _, kv := range strings.Split(split[1], ",") {
+			if strings.HasPrefix(kv, "name=") {
+				names = append(names, strings.TrimPrefix(kv, "name="))
+			}
+		}
+	}
+	return names
+}
+
+// extractSentinelMasterMetrics sends the configuration of the master name
+// found in fields, the reply of SENTINEL MASTER <name>.
+func extractSentinelMasterMetrics(name string, fields map[string]string, addr string, scrapes chan<- scrapeResult) {
+	for field, metric := range sentinelMasterFields {
+		val, err := strconv.ParseFloat(fields[field], 64)
+		if err != nil {
+			continue
+		}
+		scrapes <- scrapeResult{Name: metric, Addr: addr, Value: val, Labels: map[string]string{"master": name}}
+	}
+}
+
+// scrapeSentinelMasters exports the configuration of all masters monitored by
+// the sentinel c, so drift between sentinels watching the same master is visible.
+func scrapeSentinelMasters(c redis.Conn, info, addr string, scrapes chan<- scrapeResult) {
+	for _, name := range parseSentinelMasterNames(info) {
+		fields, err := redis.StringMap(c.Do("SENTINEL", "MASTER", name))
+		if err != nil {
+			log.WithField("target", LabelAddr(addr)).WithError(err).Debugf("SENTINEL MASTER %s failed", name)
+			continue
+		}
+		extractSentinelMasterMetrics(name, fields, addr, scrapes)
+	}
+}
+
+// SentinelNode is a redis node monitored by one of the configured sentinels.
+type SentinelNode struct {
+	// Addr is a redis:// (rediss:// if the sentinel was reached via TLS) URL.
+	Addr   string
+	Master string
+	Role   string
+	// Sentinel is the configured address of the sentinel reporting the node.
+	Sentinel string
+}
+
+// SentinelNodes asks every configured sentinel for the masters it monitors,
+// and if withReplicas is set their replicas, so they can be scraped as
+// targets of their own. Nodes that are down according to the sentinel are
+// left out. Configured addresses that aren't sentinels are skipped.
+func (e *Exporter) SentinelNodes(withReplicas bool) ([]SentinelNode, error) {
+	var nodes []SentinelNode
+	var lastErr error
+	seen := map[string]bool{}
+	for idx, addr := range e.redis.Addrs {
+		found, err := e.sentinelNodes(idx, addr, withReplicas)
+		if err != nil {
+			log.WithField("target", LabelAddr(addr)).WithError(err).Debug("sentinel discovery failed")
+			lastErr = err
+			continue
+		}
+		for _, n := range found {
+			if !seen[n.Addr] {
+				seen[n.Addr] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	if len(nodes) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return nodes, nil
+}
+
+func (e *Exporter) sentinelNodes(idx int, addr string, withReplicas bool) ([]SentinelNode, error) {
+	c, err := e.connectToRedis(idx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return sentinelNodesOf(c, addr, withReplicas)
+}
+
+// sentinelNodesOf returns the nodes monitored by c, the node addr, or none
+// if it isn't a sentinel.
+func sentinelNodesOf(c redis.Conn, addr string, withReplicas bool) ([]SentinelNode, error) {
+	info, err := redis.String(c.Do("INFO", "server"))
+	if err != nil || !isSentinel(info) {
+		return nil, err
+	}
+	if info, err = redis.String(c.Do("INFO", "sentinel")); err != nil {
+		return nil, err
+	}
+
+	scheme := "redis://"
+	if strings.HasPrefix(addr, "rediss://") {
+		scheme = "rediss://"
+	}
+	node := func(fields map[string]string, master, role string) (SentinelNode, bool) {
+		if fields["ip"] == "" || strings.Contains(fields["flags"], "s_down") || strings.Contains(fields["flags"], "o_down") {
+			return SentinelNode{}, false
+		}
+		return SentinelNode{Addr: scheme + net.JoinHostPort(fields["ip"], fields["port"]), Master: master, Role: role, Sentinel: addr}, true
+	}
+
+	var nodes []SentinelNode
+	for _, name := range parseSentinelMasterNames(info) {
+		fields, err := redis.StringMap(c.Do("SENTINEL", "MASTER", name))
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := node(fields, name, "master"); ok {
+			nodes = append(nodes, n)
+		}
+		if !withReplicas {
+			continue
+		}
+		// SENTINEL REPLICAS only exists since 5.0, SLAVES still works
+		replicas, err := redis.Values(c.Do("SENTINEL", "SLAVES", name))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range replicas {
+			fields, err := redis.StringMap(r, nil)
+			if err != nil {
+				continue
+			}
+			if n, ok := node(fields, name, "replica"); ok {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes, nil
+}
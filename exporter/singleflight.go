@@ -0,0 +1,44 @@
+package exporter
+
+import "sync"
+
+// flight is an in-progress or completed scrape of a single redis host.
+type flight struct {
+	wg      sync.WaitGroup
+	results []scrapeResult
+	err     error
+}
+
+// flightGroup coalesces concurrent scrapes of the same redis host, so that
+// simultaneous Collect calls only query redis once and share the results.
+type flightGroup struct {
+	mtx     sync.Mutex
+	flights map[string]*flight
+}
+
+// do runs fn for key, unless a call for key is already in flight in which
+// case it waits for that call and returns its results.
+func (g *flightGroup) do(key string, fn func() ([]scrapeResult, error)) ([]scrapeResult, error) {
+	g.mtx.Lock()
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mtx.Unlock()
+		f.wg.Wait()
+		return f.results, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.mtx.Unlock()
+
+	f.results, f.err = fn()
+	f.wg.Done()
+
+	g.mtx.Lock()
+	delete(g.flights, key)
+	g.mtx.Unlock()
+
+	return f.results, f.err
+}
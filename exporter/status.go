@@ -0,0 +1,120 @@
+package exporter
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TargetStatus describes a configured redis node and its last scrape.
+type TargetStatus struct {
+	Addr            string    `json:"addr"`
+	PasswordSet     bool      `json:"password_set"`
+	TLS             bool      `json:"tls"`
+	Scraped         bool      `json:"scraped"`
+	Up              bool      `json:"up"`
+	LastScrape      time.Time `json:"last_scrape"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Series          int       `json:"series"`
+	Role            string    `json:"role,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	// Failure is the kind of Error, one of the Failure constants
+	Failure string `json:"failure,omitempty"`
+}
+
+// kinds of scrape failures of TargetStatus.Failure
+const (
+	// FailureConnect means the node couldn't be reached or didn't answer
+	FailureConnect = "connect"
+	// FailureAuth means the node rejected the credentials or requires some
+	FailureAuth = "auth"
+	// FailurePartial means some of the metrics of the node were collected
+	// before the scrape failed
+	FailurePartial = "partial"
+)
+
+// authErrorPrefixes are the prefixes of the errors redis rejects
+// unauthenticated connections and wrong credentials with.
+var authErrorPrefixes = []string{"NOAUTH", "WRONGPASS", "ERR invalid password", "ERR invalid username-password pair", "ERR Client sent AUTH", "ERR AUTH"}
+
+// failureOf returns the kind of the failure err of a scrape that returned
+// results, "" if err is nil.
+func failureOf(err error, results []scrapeResult) string {
+	if err == nil {
+		return ""
+	}
+	for _, prefix := range authErrorPrefixes {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return FailureAuth
+		}
+	}
+	for _, scr := range results {
+		if scr.Name != "up" {
+			return FailurePartial
+		}
+	}
+	return FailureConnect
+}
+
+// targetStatuses keeps the outcome of the last scrape of every host.
+type targetStatuses struct {
+	mtx  sync.Mutex
+	last map[string]TargetStatus
+}
+
+func (s *targetStatuses) set(addr string, start time.Time, results []scrapeResult, err error) {
+	st := TargetStatus{Scraped: true, LastScrape: start, DurationSeconds: time.Since(start).Seconds(), Series: len(results)}
+	for _, scr := range results {
+		if scr.Name == "up" {
+			st.Up = scr.Value == 1
+		}
+		if scr.Name == "replication_is_master" && scr.Addr == addr {
+			st.Role = map[bool]string{true: "master", false: "replica"}[scr.Value == 1]
+		}
+	}
+	if err != nil {
+		st.Error, st.Failure = err.Error(), failureOf(err, results)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.last == nil {
+		s.last = map[string]TargetStatus{}
+	}
+	s.last[addr] = st
+}
+
+func (s *targetStatuses) get(addr string) TargetStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.last[addr]
+}
+
+// TargetStatuses returns the status of all configured redis nodes, in the
+// order they were configured. Credentials are redacted.
+func (e *Exporter) TargetStatuses() []TargetStatus {
+	var res []TargetStatus
+	for idx, addr := range e.redis.Addrs {
+		st := e.statuses.get(addr)
+		st.Addr = RedactAddr(addr)
+		u, _ := parseRedisURL(addr)
+		st.PasswordSet = u.auth || len(e.redis.Passwords) > idx && e.redis.Passwords[idx] != ""
+		st.TLS = strings.HasPrefix(addr, "rediss://")
+		res = append(res, st)
+	}
+	return res
+}
+
+// RedactAddr returns addr with the password of its user info, if any,
+// replaced by xxxxx.
+func RedactAddr(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.User == nil {
+		return addr
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
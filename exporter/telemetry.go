@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// telemetry are metrics about the exporter itself.
+type telemetry struct {
+	connsOpened   prometheus.Counter
+	connsClosed   prometheus.Counter
+	connErrors    prometheus.Counter
+	reconnects    prometheus.Counter
+	commandErrors *prometheus.CounterVec
+	infoBytes     prometheus.Counter
+	goroutines    prometheus.Gauge
+	seriesDropped *prometheus.CounterVec
+	scrapePanics  *prometheus.CounterVec
+	parseFailures *prometheus.CounterVec
+	targetResets  *prometheus.CounterVec
+
+	// failed are the addresses whose last connection failed, see connOpened
+	mtx    sync.Mutex
+	failed map[string]bool
+}
+
+func newTelemetry(opts Options) *telemetry {
+	namespace := opts.Namespace
+	return &telemetry{
+		connsOpened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_connections_opened_total",
+			Help:      helpText(opts, "exporter_connections_opened_total", "Total number of connections opened to redis"),
+		}),
+		connsClosed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_connections_closed_total",
+			Help:      helpText(opts, "exporter_connections_closed_total", "Total number of connections to redis closed"),
+		}),
+		connErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_connection_errors_total",
+			Help:      helpText(opts, "exporter_connection_errors_total", "Total number of failed attempts to connect to redis"),
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_reconnects_total",
+			Help:      helpText(opts, "exporter_reconnects_total", "Total number of connections opened to redis nodes after a failed attempt to connect or a broken connection"),
+		}),
+		commandErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_redis_command_errors_total",
+			Help:      helpText(opts, "exporter_redis_command_errors_total", "Total number of redis commands that returned an error, by command"),
+		}, []string{"cmd"}),
+		infoBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_info_bytes_read_total",
+			Help:      helpText(opts, "exporter_info_bytes_read_total", "Total number of bytes of INFO responses read from redis"),
+		}),
+		goroutines: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_scrape_goroutines",
+			Help:      helpText(opts, "exporter_scrape_goroutines", "Number of goroutines currently scraping a redis node"),
+		}),
+		seriesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_series_dropped_total",
+			Help:      helpText(opts, "exporter_series_dropped_total", "Total number of series dropped because the target exceeded the series limit"),
+		}, []string{"target"}),
+		scrapePanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_scrape_panics_total",
+			Help:      helpText(opts, "exporter_scrape_panics_total", "Total number of scrapes of the target aborted by a panic"),
+		}, []string{"target"}),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_parse_failures_total",
+			Help:      helpText(opts, "exporter_parse_failures_total", "Total number of exported INFO lines of the target that couldn't be parsed, by section"),
+		}, []string{"target", "section"}),
+		targetResets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_target_resets_total",
+			Help:      helpText(opts, "exporter_target_resets_total", "Total number of times the state of the target was reset after consecutive failed scrapes"),
+		}, []string{"target"}),
+		failed: map[string]bool{},
+	}
+}
+
+func (t *telemetry) describe(ch chan<- *prometheus.Desc) {
+	ch <- t.connsOpened.Desc()
+	ch <- t.connsClosed.Desc()
+	ch <- t.connErrors.Desc()
+	ch <- t.reconnects.Desc()
+	t.commandErrors.Describe(ch)
+	ch <- t.infoBytes.Desc()
+	ch <- t.goroutines.Desc()
+	t.seriesDropped.Describe(ch)
+	t.scrapePanics.Describe(ch)
+	t.parseFailures.Describe(ch)
+	t.targetResets.Describe(ch)
+}
+
+func (t *telemetry) collect(ch chan<- prometheus.Metric) {
+	ch <- t.connsOpened
+	ch <- t.connsClosed
+	ch <- t.connErrors
+	ch <- t.reconnects
+	t.commandErrors.Collect(ch)
+	ch <- t.infoBytes
+	ch <- t.goroutines
+	t.seriesDropped.Collect(ch)
+	t.scrapePanics.Collect(ch)
+	t.parseFailures.Collect(ch)
+	t.targetResets.Collect(ch)
+}
+
+// connFailed counts a failed attempt to connect to addr.
+func (t *telemetry) connFailed(addr string) {
+	t.connErrors.Inc()
+	t.setFailed(addr, true)
+}
+
+func (t *telemetry) setFailed(addr string, failed bool) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	was := t.failed[addr]
+	if failed {
+		t.failed[addr] = true
+	} else {
+		delete(t.failed, addr)
+	}
+	return was
+}
+
+// connOpened counts a connection opened to addr, as a reconnect if the last
+// attempt to connect to addr failed or its last connection broke, and wraps
+// it to count its command errors and when it's closed.
+func (t *telemetry) connOpened(addr string, c redis.Conn) redis.Conn {
+	t.connsOpened.Inc()
+	if t.setFailed(addr, false) {
+		t.reconnects.Inc()
+	}
+	return &countingConn{Conn: c, t: t, addr: addr}
+}
+
+// countingConn is a redis.Conn updating the telemetry of the exporter.
+type countingConn struct {
+	redis.Conn
+	t    *telemetry
+	addr string
+}
+
+func (c *countingConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	c.count(cmd, err)
+	return reply, err
+}
+
+// DoWithTimeout and ReceiveWithTimeout implement redis.ConnWithTimeout.
+func (c *countingConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	c.count(cmd, err)
+	return reply, err
+}
+
+// count counts the error of cmd. Errors other than error replies of redis,
+// e.g. timeouts, break the connection, so the next one to addr is counted
+// as a reconnect.
+func (c *countingConn) count(cmd string, err error) {
+	if err == nil || err == redis.ErrNil {
+		return
+	}
+	c.t.commandErrors.WithLabelValues(strings.ToLower(cmd)).Inc()
+	if _, reply := err.(redis.Error); !reply {
+		c.t.setFailed(c.addr, true)
+	}
+}
+
+func (c *countingConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *countingConn) Close() error {
+	c.t.connsClosed.Inc()
+	return c.Conn.Close()
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"strings"
+	"time"
+)
+
+// phases of a scrape reported by TimeScrape
+const (
+	phaseDial         = "dial"
+	phaseAuth         = "auth"
+	phaseInfo         = "info"
+	phaseParse        = "parse"
+	phaseCommandStats = "commandstats"
+	phaseCluster      = "cluster"
+	phaseConfig       = "config"
+	phaseKeys         = "keys"
+	phaseWait         = "wait"
+	phaseMonitor      = "monitor"
+)
+
+// ScrapePhase is the time spent in one phase of a scrape.
+type ScrapePhase struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+}
+
+// ScrapeTiming is the breakdown of a scrape of a single node by phase:
+// dial, auth (AUTH, SELECT and CLIENT SETNAME), info (the INFO round trip),
+// parse and commandstats (parsing INFO, without and with only the
+// Commandstats section), cluster (CLUSTER INFO and NODES), config (the
+// CONFIG based metrics), keys (key checks, key groups and keyspace
+// sampling), wait and monitor. Phases that didn't run are left out.
+type ScrapeTiming struct {
+	Target  string        `json:"target"`
+	Seconds float64       `json:"seconds"`
+	Phases  []ScrapePhase `json:"phases"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// phaseTimer sums up the time spent per phase of a scrape in the order the
+// phases first ran, recording a span of every phase below span if it's set.
+// A nil phaseTimer doesn't time anything.
+type phaseTimer struct {
+	phases []ScrapePhase
+	span   *Span
+}
+
+func (t *phaseTimer) add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	for i := range t.phases {
+		if t.phases[i].Phase == phase {
+			t.phases[i].Seconds += d.Seconds()
+			return
+		}
+	}
+	t.phases = append(t.phases, ScrapePhase{Phase: phase, Seconds: d.Seconds()})
+}
+
+// since adds the time since start to phase.
+func (t *phaseTimer) since(phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.add(phase, now.Sub(start))
+	t.span.childAt(phase, start, now)
+}
+
+// traceSpan returns the span the phases are recorded below, nil if the
+// scrape isn't traced.
+func (t *phaseTimer) traceSpan() *Span {
+	if t == nil {
+		return nil
+	}
+	return t.span
+}
+
+// extractInfoTimed is extractInfoMetrics, timing the parse of the
+// Commandstats section separately from the rest of info.
+func (e *Exporter) extractInfoTimed(info, addr string, scrapes chan<- scrapeResult, t *phaseTimer) {
+	if t == nil {
+		e.extractInfoMetrics(info, addr, scrapes)
+		return
+	}
+	start := time.Now()
+	last, inCmdStats := start, false
+	var cmdStats time.Duration
+	e.extractInfoMetricsTraced(info, addr, scrapes, func(line, action string) {
+		now := time.Now()
+		if inCmdStats {
+			cmdStats += now.Sub(last)
+		}
+		last = now
+		if action == "section" {
+			inCmdStats = strings.Contains(line, "Commandstats")
+		}
+	})
+	end := time.Now()
+	t.add(phaseParse, end.Sub(start)-cmdStats)
+	t.span.childAt(phaseParse, start, end)
+	if cmdStats > 0 {
+		t.add(phaseCommandStats, cmdStats)
+	}
+}
+
+// TimeScrape scrapes the redis node addr like a regular scrape and returns
+// the time spent per phase. The results only update the key metrics, which
+// are set during the scrape.
+func (e *Exporter) TimeScrape(addr string) ScrapeTiming {
+	t := &phaseTimer{}
+	scrapes := make(chan scrapeResult)
+	done := make(chan struct{})
+	go func() {
+		for range scrapes {
+		}
+		close(done)
+	}()
+
+	start := time.Now()
+	err := e.scrapeRedisHost(e.addrIndex(addr), addr, scrapes, t)
+	close(scrapes)
+	<-done
+
+	timing := ScrapeTiming{Target: LabelAddr(addr), Seconds: time.Since(start).Seconds(), Phases: t.phases}
+	if timing.Phases == nil {
+		timing.Phases = []ScrapePhase{}
+	}
+	if err != nil {
+		timing.Error = err.Error()
+	}
+	return timing
+}
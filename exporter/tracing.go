@@ -0,0 +1,328 @@
+package exporter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// maxPendingExports is the number of traces being sent to the collector at
+// the same time, traces finished while that many are in flight are dropped.
+const maxPendingExports = 4
+
+// Tracer sends a trace of every scrape to an OpenTelemetry collector via
+// OTLP/HTTP (JSON encoding): a span of the scrape, its targets, their phases
+// (see ScrapeTiming) and the redis commands. See Options.Tracer.
+type Tracer struct {
+	endpoint string
+	service  string
+	ratio    float64
+	client   *http.Client
+	pending  chan struct{}
+}
+
+// NewTracer returns a tracer exporting to the OTLP/HTTP endpoint, e.g.
+// http://otel-collector:4318 (/v1/traces is added if there is no path).
+// ratio (0 to 1) is the fraction of scrapes traced.
+func NewTracer(endpoint, service string, ratio float64) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected http(s)://host:port", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %v, must be between 0 and 1", ratio)
+	}
+	return &Tracer{
+		endpoint: u.String(),
+		service:  service,
+		ratio:    ratio,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pending:  make(chan struct{}, maxPendingExports),
+	}, nil
+}
+
+// sampled decides whether a new trace is recorded.
+func (t *Tracer) sampled() bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<30))
+	return err == nil && float64(n.Int64()) < t.ratio*(1<<30)
+}
+
+// Span is a span of a trace, a nil Span (not traced) ignores all calls.
+type Span struct {
+	trace    *traceSpans
+	id       string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      string
+}
+
+// traceSpans are the finished spans of a trace, sent when its root ends.
+type traceSpans struct {
+	tracer *Tracer
+	id     string
+	mtx    sync.Mutex
+	spans  []*Span
+}
+
+// OTLP span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// startSpan starts a span, a new trace unless parent is set. It returns nil
+// if t is nil or the trace isn't sampled.
+func (t *Tracer) startSpan(name string, parent *Span) *Span {
+	if parent != nil {
+		return parent.child(name)
+	}
+	if t == nil || !t.sampled() {
+		return nil
+	}
+	return &Span{trace: &traceSpans{tracer: t, id: randomID(16)}, id: randomID(8), name: name, kind: spanKindInternal, start: time.Now()}
+}
+
+// child starts a span below s.
+func (s *Span) child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{trace: s.trace, id: randomID(8), parentID: s.id, name: name, kind: spanKindInternal, start: time.Now()}
+}
+
+// childAt records a finished span below s that ran from start to end.
+func (s *Span) childAt(name string, start, end time.Time) {
+	if c := s.child(name); c != nil {
+		c.start = start
+		c.finishAt(end)
+	}
+}
+
+func (s *Span) setAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = map[string]string{}
+	}
+	s.attrs[key] = value
+}
+
+func (s *Span) setError(err error) {
+	if s != nil && err != nil {
+		s.err = err.Error()
+	}
+}
+
+// finish ends s, ending the root span sends the trace.
+func (s *Span) finish() {
+	s.finishAt(time.Now())
+}
+
+func (s *Span) finishAt(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.end = end
+	s.trace.mtx.Lock()
+	s.trace.spans = append(s.trace.spans, s)
+	spans := s.trace.spans
+	s.trace.mtx.Unlock()
+	if s.parentID == "" {
+		s.trace.tracer.send(s.trace.id, spans)
+	}
+}
+
+// send exports the spans of a trace in the background.
+func (t *Tracer) send(traceID string, spans []*Span) {
+	select {
+	case t.pending <- struct{}{}:
+	default:
+		log.Debugf("dropped trace %s, too many traces being sent", traceID)
+		return
+	}
+	body, err := json.Marshal(t.request(traceID, spans))
+	if err != nil {
+		<-t.pending
+		log.WithError(err).Debug("couldn't encode trace")
+		return
+	}
+	go func() {
+		defer func() { <-t.pending }()
+		resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.WithError(err).Debug("couldn't send trace")
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			log.Debugf("couldn't send trace, collector returned %s", resp.Status)
+		}
+	}()
+}
+
+// otlpAttr is an attribute of the OTLP JSON encoding, only strings are used.
+type otlpAttr struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttrs(attrs map[string]string) []otlpAttr {
+	var res []otlpAttr
+	for k, v := range attrs {
+		a := otlpAttr{Key: k}
+		a.Value.StringValue = v
+		res = append(res, a)
+	}
+	return res
+}
+
+// request returns the OTLP ExportTraceServiceRequest of the spans.
+func (t *Tracer) request(traceID string, spans []*Span) interface{} {
+	var otlpSpans []interface{}
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           traceID,
+			"spanId":            s.id,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttrs(s.attrs),
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		if s.err != "" {
+			// STATUS_CODE_ERROR
+			span["status"] = map[string]interface{}{"code": 2, "message": s.err}
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttrs(map[string]string{"service.name": t.service})},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "redis_exporter"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+}
+
+// randomID returns n random bytes hex encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracedConn records a span of every command sent with Do below span.
+// Pipelined commands are recorded as a single span from the flush to their
+// last reply.
+type tracedConn struct {
+	redis.Conn
+	span    *Span
+	pending []string
+
+	// pipeline is the span of the flushed commands until all of their
+	// replies are received
+	pipeline *Span
+	replies  int
+}
+
+// traceConn returns c recording its commands below span, c if span is nil.
+func traceConn(c redis.Conn, span *Span) redis.Conn {
+	if span == nil {
+		return c
+	}
+	return &tracedConn{Conn: c, span: span}
+}
+
+func (c *tracedConn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, strings.ToUpper(cmd))
+	return c.Conn.Send(cmd, args...)
+}
+
+// commandSpan starts the span of the command cmd, "" for the pending
+// pipelined commands.
+func (c *tracedConn) commandSpan(cmd string) *Span {
+	name := strings.ToUpper(cmd)
+	if cmd == "" {
+		name = "pipeline"
+	}
+	s := c.span.child("redis " + name)
+	s.kind = spanKindClient
+	s.setAttr("db.system", "redis")
+	if cmd != "" {
+		s.setAttr("db.operation", name)
+	}
+	if len(c.pending) > 0 {
+		s.setAttr("redis.pipeline", strings.Join(c.pending, " "))
+		c.pending = nil
+	}
+	return s
+}
+
+func (c *tracedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	s := c.commandSpan(cmd)
+	reply, err := c.Conn.Do(cmd, args...)
+	s.setError(err)
+	s.finish()
+	return reply, err
+}
+
+func (c *tracedConn) Flush() error {
+	if len(c.pending) > 0 && c.pipeline == nil {
+		c.replies = len(c.pending)
+		c.pipeline = c.commandSpan("")
+	}
+	err := c.Conn.Flush()
+	if err != nil && c.pipeline != nil {
+		c.pipeline.setError(err)
+		c.pipeline.finish()
+		c.pipeline = nil
+	}
+	return err
+}
+
+func (c *tracedConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	if c.pipeline != nil {
+		c.replies--
+		c.pipeline.setError(err)
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			// the connection failed, the other replies won't be received
+			c.replies = 0
+		}
+		if c.replies <= 0 {
+			c.pipeline.finish()
+			c.pipeline = nil
+		}
+	}
+	return reply, err
+}
@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// features are the commands a redis node supports, derived from the
+// redis_version of its INFO response. Commands it doesn't support are
+// skipped instead of failing on every scrape.
+type features struct {
+	scan           bool // SCAN, 2.8
+	pfcount        bool // PFCOUNT, 2.8.9
+	wait           bool // WAIT, 3.0
+	geo            bool // GEORADIUS, 3.2
+	memoryUsage    bool // MEMORY USAGE, 4.0
+	infoEverything bool // INFO everything with the Latencystats section, 7.0
+	hashFieldTTL   bool // HPTTL, 7.4
+}
+
+// allFeatures is assumed for nodes whose version is unknown, e.g. forks
+// reporting something else than redis_version.
+var allFeatures = features{scan: true, pfcount: true, wait: true, geo: true, memoryUsage: true, infoEverything: true, hashFieldTTL: true}
+
+// parseRedisVersion returns the major, minor and patch number of the
+// redis_version field of info.
+func parseRedisVersion(info string) ([3]int, bool) {
+	var v [3]int
+	for _, line := range strings.Split(info, "\r\n") {
+		if !strings.HasPrefix(line, "redis_version:") {
+			continue
+		}
+		frags := strings.Split(strings.TrimPrefix(line, "redis_version:"), ".")
+		for i := 0; i < len(frags) && i < 3; i++ {
+			n, err := strconv.Atoi(frags[i])
+			if err != nil {
+				return v, false
+			}
+			v[i] = n
+		}
+		return v, true
+	}
+	return v, false
+}
+
+// atLeast returns true if v is major.minor.patch or newer.
+func atLeast(v [3]int, major, minor, patch int) bool {
+	want := [3]int{major, minor, patch}
+	for i := range v {
+		if v[i] != want[i] {
+			return v[i] > want[i]
+		}
+	}
+	return true
+}
+
+// featuresOf returns the features of the node that sent info.
+func featuresOf(info string) features {
+	v, ok := parseRedisVersion(info)
+	if !ok {
+		return allFeatures
+	}
+	return features{
+		scan:           atLeast(v, 2, 8, 0),
+		pfcount:        atLeast(v, 2, 8, 9),
+		wait:           atLeast(v, 3, 0, 0),
+		geo:            atLeast(v, 3, 2, 0),
+		memoryUsage:    atLeast(v, 4, 0, 0),
+		infoEverything: atLeast(v, 7, 0, 0),
+		hashFieldTTL:   atLeast(v, 7, 4, 0),
+	}
+}
+
+// nodeFeatures remembers the features of every scraped node, for choosing
+// the INFO section of its next scrape before its version is known.
+type nodeFeatures struct {
+	mtx  sync.Mutex
+	last map[string]features
+}
+
+func (n *nodeFeatures) set(addr string, f features) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.last == nil {
+		n.last = map[string]features{}
+	}
+	n.last[addr] = f
+}
+
+func (n *nodeFeatures) get(addr string) features {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.last[addr]
+}
+
+// infoSection returns the argument of INFO for the node addr, everything if
+// it was found to be redis 7 or newer, otherwise all.
+func (e *Exporter) infoSection(addr string) string {
+	if e.nodeFeatures.get(addr).infoEverything {
+		return "everything"
+	}
+	return "ALL"
+}
@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// waitProbeKey is written by the WAIT probe, it expires on its own.
+	waitProbeKey       = "redis_exporter:wait_probe"
+	waitProbeKeyTTL    = 60 * 1000
+	defaultWaitTimeout = time.Second
+)
+
+// waitProbeKeyFor returns the probe key to write on the node described by
+// nodes. In cluster mode a hash tag is added so the key belongs to a slot
+// served by the node itself, "" means the node serves no slots.
+func waitProbeKeyFor(nodes clusterNodes) string {
+	if nodes.myself == "" {
+		return waitProbeKey
+	}
+	for i := 0; i < 100000; i++ {
+		key := fmt.Sprintf("%s{%d}", waitProbeKey, i)
+		if nodes.owner(keyHashSlot(key)) == nodes.myself {
+			return key
+		}
+	}
+	return ""
+}
+
+// probeWait writes the probe key on the master c is connected to and waits
+// for the configured number of replicas to acknowledge it, exporting how many
+// did and how long it took. The key is written to the db of addr, the key
+// checks and SCANs before may have selected another one.
+func (e *Exporter) probeWait(c redis.Conn, addr string, nodes clusterNodes, scrapes chan<- scrapeResult) {
+	key := waitProbeKeyFor(nodes)
+	if key == "" {
+		return
+	}
+	timeout := e.opts.WaitProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+
+	entry := log.WithField("target", LabelAddr(addr))
+	db := "0"
+	if u, _ := parseRedisURL(addr); u.db != "" {
+		db = u.db
+	}
+	if _, err := c.Do("SELECT", db); err != nil {
+		entry.WithError(err).Debug("selecting the db of the WAIT probe key failed")
+		return
+	}
+	if _, err := c.Do("SET", key, time.Now().Unix(), "PX", waitProbeKeyTTL); err != nil {
+		entry.WithError(err).Debug("writing WAIT probe key failed")
+		return
+	}
+	start := time.Now()
+	acked, err := redis.Int64(c.Do("WAIT", e.opts.WaitProbeReplicas, int64(timeout/time.Millisecond)))
+	if err != nil {
+		entry.WithError(err).Debug("WAIT failed")
+		return
+	}
+	scrapes <- scrapeResult{Name: "replication_wait_acked_replicas", Addr: addr, Value: float64(acked)}
+	scrapes <- scrapeResult{Name: "replication_wait_duration_seconds", Addr: addr, Value: time.Since(start).Seconds()}
+}
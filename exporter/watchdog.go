@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// failureWatchdog counts the consecutive failed scrapes of every node.
+type failureWatchdog struct {
+	mtx      sync.Mutex
+	failures map[string]int
+}
+
+// record records the outcome of a scrape of addr and returns true if it was
+// the limit-th failure in a row, starting the count over. A limit of 0
+// never returns true.
+func (w *failureWatchdog) record(addr string, err error, limit int) bool {
+	if limit <= 0 {
+		return false
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if err == nil {
+		delete(w.failures, addr)
+		return false
+	}
+	if w.failures == nil {
+		w.failures = map[string]int{}
+	}
+	w.failures[addr]++
+	if w.failures[addr] < limit {
+		return false
+	}
+	delete(w.failures, addr)
+	return true
+}
+
+// resetTarget drops everything kept about the node addr between scrapes:
+// its features (the INFO section to ask for), the cached results, the state
+// of its SCANs and the replicas discovered on it, so the next scrape starts
+// over like the first one after a restart. There is no connection pool to
+// rebuild: the connections of a scrape are closed when it's done and the
+// next scrape dials, and resolves the address, again.
+func (e *Exporter) resetTarget(addr string, failures int) {
+	e.nodeFeatures.forget(addr)
+	e.cache.forget(addr)
+	e.keyCache.forget(addr)
+	e.scans.forget(addr)
+	e.replicas.forget(addr)
+	e.telemetryOf(addr).targetResets.WithLabelValues(LabelAddr(addr)).Inc()
+	log.WithField("target", LabelAddr(addr)).Warnf("%d scrapes failed in a row, reset the state of the target", failures)
+}
+
+func (n *nodeFeatures) forget(addr string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	delete(n.last, addr)
+}
+
+func (c *resultCache) forget(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.entries, key)
+}
+
+// forget drops the state of all SCANs of addr.
+func (s *scanStates) forget(addr string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for key := range s.states {
+		if strings.HasPrefix(key, addr+"\x00") {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (r *replicaSet) forget(master string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.replicas, master)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	healthcheckPing    *bool
+	healthcheckTimeout *time.Duration
+)
+
+func healthcheckFlags() {
+	healthcheckPing = flag.Bool("healthcheck.ping", false, "PING all redis nodes instead of querying the /-/healthy endpoint of the local exporter")
+	healthcheckTimeout = flag.Duration("healthcheck.timeout", 5*time.Second, "Timeout of the /-/healthy request")
+}
+
+// healthcheck exits 0 if the local exporter (or with --healthcheck.ping all
+// redis nodes) is healthy and 1 otherwise, suitable for a Docker HEALTHCHECK.
+func healthcheck() int {
+	if *healthcheckPing {
+		inst, _, err := newExporter()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, addr := range inst.addrs {
+			if err := inst.exp.Ping(addr); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", addr, err)
+				return 1
+			}
+		}
+		return 0
+	}
+
+	transport := &http.Transport{}
+	if path, ok := socketPath(flags.listenAddress); ok {
+		transport.Dial = func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		}
+	}
+	url := healthyURL(flags.listenAddress)
+	if flags.webTLSCert != "" {
+		// the local exporter is trusted, its own certificate is presented
+		// in case it requires client certificates
+		cert, err := tls.LoadX509KeyPair(flags.webTLSCert, flags.webTLSKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}
+		url = "https" + strings.TrimPrefix(url, "http")
+	}
+	client := http.Client{Timeout: *healthcheckTimeout, Transport: transport}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "unhealthy, status: %s\n", resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// healthyURL returns the URL of the /-/healthy endpoint of an exporter listening on listenAddress.
+func healthyURL(listenAddress string) string {
+	if _, ok := socketPath(listenAddress); ok {
+		// the host is ignored, requests are sent to the socket
+		return "http://localhost/-/healthy"
+	}
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		host, port = "", "9121"
+	}
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s/-/healthy", net.JoinHostPort(host, port))
+}
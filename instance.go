@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/oliver006/redis_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// instance is an exporter together with everything needed to serve it, its
+// own registry and HTTP handlers, so several of them can run in the same
+// process without sharing any state.
+type instance struct {
+	name  string
+	exp   *exporter.Exporter
+	addrs []string
+
+	// opts are the options of exporters created for /scrape requests
+	opts exporter.Options
+
+	// settings are the flags and config file settings the instance was
+	// created with
+	settings *settings
+
+	// passwords are the passwords of the configured redis nodes, used when
+	// they are scraped via /scrape
+	passwords map[string]string
+
+	// aliases are the aliases of the config file by address, for /sd
+	aliases map[string]string
+
+	// modules are the scrape profiles of /scrape?module=...
+	modules map[string]ModuleConfig
+
+	// registered are the targets registered at runtime, see registry.go
+	registered *targetRegistry
+
+	// probes are the exporters of the /scrape targets
+	probes probeExporters
+
+	// allowlist are the other targets /scrape may connect to, nil allows
+	// all, rejectedTargets counts the rejected ones
+	allowlist       *targetAllowlist
+	rejectedTargets prometheus.Counter
+
+	// allowedMetrics are the metrics served if not nil, see
+	// --metrics.allowlist-file
+	allowedMetrics map[string]bool
+
+	registerer prometheus.Registerer
+	metrics    http.Handler
+
+	// stopBackground stops the background scrapes of the exporter
+	stopBackground func()
+}
+
+// newInstance creates the exporter of the redis nodes addrs. The instance
+// named "" uses the default prometheus registry, which also holds the go
+// and process metrics, all others get a registry of their own.
+func newInstance(name string, addrs, passwords []string, opts exporter.Options, s *settings) (*instance, error) {
+	exp, err := exporter.NewRedisExporterWithOptions(exporter.RedisHost{Addrs: addrs, Passwords: passwords}, opts)
+	if err != nil {
+		return nil, err
+	}
+	inst := &instance{name: name, exp: exp, addrs: addrs, opts: opts, settings: s, passwords: map[string]string{}, registered: newTargetRegistry()}
+	inst.rejectedTargets = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "redis_exporter_scrape_rejected_targets_total",
+		Help: "Number of /scrape requests rejected because their target isn't allowed",
+	})
+	for idx, addr := range addrs {
+		inst.passwords[addr] = passwords[idx]
+	}
+	if s.metricsAllowlist != "" {
+		if inst.allowedMetrics, err = loadMetricAllowlist(s.metricsAllowlist); err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "" {
+		inst.registerer, inst.metrics = prometheus.DefaultRegisterer, prometheus.Handler()
+		if s.maxScrapeSeries > 0 || s.maxRespBytes > 0 || inst.allowedMetrics != nil {
+			inst.metrics = prometheus.InstrumentHandler("prometheus", inst.gathererHandler(prometheus.DefaultGatherer))
+		}
+	} else {
+		registry := prometheus.NewRegistry()
+		inst.registerer, inst.metrics = registry, inst.gathererHandler(registry)
+	}
+	return inst, nil
+}
+
+// startBackground starts the background scrapes of the exporter, if
+// enabled, until stopBackground is called.
+func (i *instance) startBackground() {
+	i.stopBackground = i.exp.ScrapeInBackground()
+}
+
+// gathererHandler serves the metrics of g listed in --metrics.allowlist-file,
+// capped by --max-series-per-scrape and --max-response-bytes.
+func (i *instance) gathererHandler(g prometheus.Gatherer) http.Handler {
+	if i.allowedMetrics != nil {
+		g = allowlistGatherer{g: g, names: i.allowedMetrics}
+	}
+	if i.settings.maxScrapeSeries > 0 || i.settings.maxRespBytes > 0 {
+		g = truncatingGatherer{g: g, maxSeries: i.settings.maxScrapeSeries, maxBytes: i.settings.maxRespBytes, namespace: i.opts.Namespace}
+	}
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// register registers c, the exporter of the instance or a collector
+// delegating to it, the build info and the rejected /scrape targets with the
+// registry of the instance.
+func (i *instance) register(c prometheus.Collector) error {
+	if err := i.registerer.Register(c); err != nil {
+		return err
+	}
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "redis_exporter_build_info",
+		Help: "redis exporter build_info",
+	}, []string{"version", "commit_sha", "build_date", "golang_version"})
+	buildInfo.WithLabelValues(VERSION, COMMIT_SHA1, BUILD_DATE, runtime.Version()).Set(1)
+	if err := i.registerer.Register(buildInfo); err != nil {
+		return err
+	}
+	return i.registerer.Register(i.rejectedTargets)
+}
+
+// handler returns the HTTP handler serving the metrics and all other
+// endpoints of the instance.
+func (i *instance) handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(i.settings.metricPath, i.metrics)
+	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/scrape", i.scrapeHandler)
+	mux.HandleFunc("/api/scan", scanAPIHandler(i.exp, i.addrs, i.settings.scanAPILimit))
+	mux.HandleFunc("/api/targets", targetsAPIHandler(i.exp))
+	if i.settings.targetsAPI {
+		mux.HandleFunc("/api/targets/register", i.registerAPIHandler)
+	}
+	mux.HandleFunc("/sd", i.sdHandler)
+	mux.HandleFunc("/debug/info", func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if !contains(i.addrs, target) {
+			http.Error(w, fmt.Sprintf("unknown target %q", target), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := i.exp.DumpInfo(target, w); err != nil {
+			fmt.Fprintf(w, "error: %s\n", err)
+		}
+	})
+	mux.HandleFunc("/debug/scrape", func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if !contains(i.addrs, target) {
+			http.Error(w, fmt.Sprintf("unknown target %q", target), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(i.exp.TimeScrape(target))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`
+<html>
+<head><title>Redis Exporter v` + VERSION + `</title></head>
+<body>
+<h1>Redis Exporter v` + VERSION + `</h1>
+<p><a href='` + i.settings.metricPath + `'>Metrics</a></p>
+</body>
+</html>
+						`))
+	})
+	return mux
+}
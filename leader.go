@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fileLease elects the leader of several exporter replicas sharing a lock
+// file, e.g. on a shared volume. The leader holds a lease it renews at a
+// third of its duration, the others take over once it expired. Replicas
+// compare the expiry written by another replica with their own clock, so
+// their clocks must be in sync to well within the lease duration.
+type fileLease struct {
+	path     string
+	duration time.Duration
+	id       string
+
+	mtx    sync.Mutex
+	leader bool
+}
+
+var (
+	electionOnce sync.Once
+	election     *fileLease
+)
+
+// leaderElection returns the election of --ha.lock-file, starting it with
+// the settings s of the first call.
+func leaderElection(s *settings) *fileLease {
+	electionOnce.Do(func() {
+		host, _ := os.Hostname()
+		election = &fileLease{path: s.haLockFile, duration: s.haLease, id: fmt.Sprintf("%s/%d", host, os.Getpid())}
+		election.renew()
+		go func() {
+			for range time.Tick(election.duration / 3) {
+				election.renew()
+			}
+		}()
+	})
+	return election
+}
+
+// isLeader returns whether this replica currently holds the lease.
+func (l *fileLease) isLeader() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.leader
+}
+
+// renew takes or extends the lease if it's free, expired or already ours.
+// The lease is read and written while holding the guard file, so of several
+// replicas taking over an expired lease at the same time only one wins. If
+// another replica holds the guard, this one stays leader as long as its
+// lease is valid and retries on the next renewal.
+func (l *fileLease) renew() {
+	leader := false
+	locked, err := l.lock()
+	if err != nil {
+		log.Warnf("Couldn't create guard file of lock file %s, err: %s", l.path, err)
+	}
+	holder, expires, err := l.read()
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Couldn't read lock file %s, err: %s", l.path, err)
+	}
+	if !locked {
+		leader = err == nil && holder == l.id && time.Now().Before(expires)
+	} else {
+		if err != nil || holder == l.id || time.Now().After(expires) {
+			if err := l.write(); err != nil {
+				log.Warnf("Couldn't write lock file %s, err: %s", l.path, err)
+			} else {
+				leader = true
+			}
+		}
+		l.unlock()
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if leader != l.leader {
+		log.Printf("Leader election: this replica (%s) is now the %s", l.id, map[bool]string{true: "leader", false: "standby"}[leader])
+	}
+	l.leader = leader
+}
+
+// guard is the file held by the replica reading and writing the lease.
+func (l *fileLease) guard() string {
+	return l.path + ".guard"
+}
+
+// lock takes the guard file by creating it exclusively, it returns false
+// if another replica holds it. A guard older than the lease duration was
+// left behind by a replica that died holding it and is removed, so the
+// guard can be taken on the next renewal.
+func (l *fileLease) lock() (bool, error) {
+	f, err := os.OpenFile(l.guard(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		return true, f.Close()
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+	if fi, err := os.Stat(l.guard()); err == nil && time.Since(fi.ModTime()) > l.duration {
+		log.Warnf("Removing stale guard file %s", l.guard())
+		os.Remove(l.guard())
+	}
+	return false, nil
+}
+
+// unlock releases the guard file.
+func (l *fileLease) unlock() {
+	if err := os.Remove(l.guard()); err != nil {
+		log.Warnf("Couldn't remove guard file %s, err: %s", l.guard(), err)
+	}
+}
+
+// read returns the holder of the lease and when it expires.
+func (l *fileLease) read() (string, time.Time, error) {
+	b, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	frags := strings.Fields(string(b))
+	if len(frags) != 2 {
+		return "", time.Time{}, fmt.Errorf("invalid content %q", b)
+	}
+	nanos, err := strconv.ParseInt(frags[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid expiry %q", frags[1])
+	}
+	return frags[0], time.Unix(0, nanos), nil
+}
+
+// write replaces the lock file with a lease of this replica, via a rename
+// so other replicas never read a partial file.
+func (l *fileLease) write() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(tmp, "%s %d\n", l.id, time.Now().Add(l.duration).UnixNano())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// collector returns the exporter_leader metric of the election.
+func (l *fileLease) collector() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: flags.namespace,
+		Name:      "exporter_leader",
+		Help:      "Whether this replica is the leader of --ha.lock-file (1) or on standby (0)",
+	}, func() float64 {
+		if l.isLeader() {
+			return 1
+		}
+		return 0
+	})
+}
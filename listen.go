@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// unixSocketPrefix marks listen addresses of Unix domain sockets, e.g.
+// unix:///run/redis_exporter.sock.
+const unixSocketPrefix = "unix://"
+
+// socketPath returns the path of the Unix domain socket listenAddress, ok is
+// false for TCP addresses.
+func socketPath(listenAddress string) (string, bool) {
+	if !strings.HasPrefix(listenAddress, unixSocketPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(listenAddress, unixSocketPrefix), true
+}
+
+// parseSocketMode parses the octal permissions of --web.socket-mode.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permissions like 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// webServer are the settings of the web interface.
+type webServer struct {
+	// mode are the permissions of Unix domain sockets
+	mode os.FileMode
+	// tls serves via HTTPS unless nil
+	tls *tls.Config
+	// sources are the networks clients may connect from, nil allows all
+	sources []*net.IPNet
+}
+
+// listen listens on the TCP address or Unix domain socket listenAddress.
+// The socket gets the permissions of w, the socket file of a previous run
+// that wasn't cleaned up (nobody accepts connections on it) is replaced.
+func (w webServer) listen(listenAddress string) (net.Listener, error) {
+	path, ok := socketPath(listenAddress)
+	if !ok {
+		return net.Listen("tcp", listenAddress)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("empty socket path in %q", listenAddress)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, w.mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// shutdown closes the Unix domain socket listeners (which removes their
+// socket files) on SIGINT and SIGTERM, ending serve. Without sockets the
+// signals keep their default behavior.
+var shutdown struct {
+	mtx       sync.Mutex
+	once      sync.Once
+	listeners []net.Listener
+	done      int32
+}
+
+// closeOnShutdown closes listener on shutdown if it's a Unix domain socket.
+func closeOnShutdown(listener net.Listener) {
+	if _, ok := listener.(*net.UnixListener); !ok {
+		return
+	}
+	shutdown.mtx.Lock()
+	shutdown.listeners = append(shutdown.listeners, listener)
+	shutdown.mtx.Unlock()
+	shutdown.once.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-ch
+			log.Infof("Received %s, shutting down", sig)
+			atomic.StoreInt32(&shutdown.done, 1)
+			shutdown.mtx.Lock()
+			defer shutdown.mtx.Unlock()
+			for _, l := range shutdown.listeners {
+				l.Close()
+			}
+		}()
+	})
+}
+
+// serve serves handler on listener until the exporter is shut down.
+func (w webServer) serve(listener net.Listener, handler http.Handler) error {
+	closeOnShutdown(listener)
+	if w.sources != nil {
+		listener = sourceFilter{Listener: listener, sources: w.sources}
+	}
+	if w.tls != nil {
+		listener = tls.NewListener(listener, w.tls)
+	}
+	err := http.Serve(listener, handler)
+	if atomic.LoadInt32(&shutdown.done) == 1 {
+		return nil
+	}
+	return err
+}
+
+// sourceFilter closes the connections of clients outside of sources right
+// after accepting them, before any data is read. Connections to Unix domain
+// sockets have no address and are always accepted.
+type sourceFilter struct {
+	net.Listener
+	sources []*net.IPNet
+}
+
+func (f sourceFilter) Accept() (net.Conn, error) {
+	for {
+		c, err := f.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		addr, ok := c.RemoteAddr().(*net.TCPAddr)
+		if !ok || containsIP(f.sources, addr.IP) {
+			return c, nil
+		}
+		log.Debugf("Rejected connection from %s", addr)
+		c.Close()
+	}
+}
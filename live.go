@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// maximum size of a config posted to /api/config
+const maxConfigSize = 1 << 20
+
+// liveInstance serves the main instance, which POST /api/config (with
+// --web.enable-config-api) replaces at runtime without restarting the
+// listener or re-registering metrics: requests and scrapes are served by
+// either the old or the new instance.
+type liveInstance struct {
+	mtx  sync.RWMutex
+	inst *instance
+	mux  http.Handler
+	cfg  *Config
+
+	// configAPI mounts /api/config
+	configAPI bool
+	// applyMtx serializes config changes
+	applyMtx sync.Mutex
+}
+
+func newLiveInstance(inst *instance, cfg *Config, configAPI bool) *liveInstance {
+	l := &liveInstance{configAPI: configAPI}
+	l.replace(inst, cfg)
+	return l
+}
+
+func (l *liveInstance) replace(inst *instance, cfg *Config) {
+	old, _, _ := l.current()
+	if old != nil {
+		inst.registered = old.registered
+		old.stopBackground()
+	}
+	inst.startBackground()
+	mux := inst.handler()
+	if l.configAPI {
+		mux.HandleFunc("/api/config", l.configAPIHandler)
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.inst, l.mux, l.cfg = inst, mux, cfg
+}
+
+// current returns the instance, its handler and its config.
+func (l *liveInstance) current() (*instance, http.Handler, *Config) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.inst, l.mux, l.cfg
+}
+
+// instance returns the current instance.
+func (l *liveInstance) instance() *instance {
+	inst, _, _ := l.current()
+	return inst
+}
+
+// exporter returns the exporter of the current instance.
+func (l *liveInstance) exporter() *exporter.Exporter {
+	inst, _, _ := l.current()
+	return inst.exp
+}
+
+// Describe implements prometheus.Collector
+func (l *liveInstance) Describe(ch chan<- *prometheus.Desc) {
+	l.exporter().Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (l *liveInstance) Collect(ch chan<- prometheus.Metric) {
+	l.exporter().Collect(ch)
+}
+
+func (l *liveInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, mux, _ := l.current()
+	mux.ServeHTTP(w, r)
+}
+
+// configAPIHandler serves POST /api/config, validating the posted config
+// (the format of --config.file) and applying it in place of the current
+// one. Flags passed on the command line keep taking precedence. The
+// response lists the settings that changed.
+func (l *liveInstance) configAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(body, cfg); err != nil {
+		http.Error(w, fmt.Sprintf("invalid config: %s", err), http.StatusBadRequest)
+		return
+	}
+	errs := cfg.validate()
+	var running []InstanceConfig
+	if _, _, current := l.current(); current != nil {
+		running = current.Instances
+	}
+	if (len(running) > 0 || len(cfg.Instances) > 0) && !reflect.DeepEqual(running, cfg.Instances) {
+		errs = append(errs, fmt.Errorf("instances: can't be changed at runtime"))
+	}
+	if len(errs) > 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		http.Error(w, strings.Join(msgs, "\n"), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := l.apply(cfg)
+	if err != nil {
+		log.WithError(err).Error("couldn't apply config")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Applied config posted to /api/config, %d changes", len(changes))
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string][]string{"changes": changes})
+}
+
+// apply creates the instance of cfg and replaces the current one with it,
+// returning the settings that changed. The settings of the new instance
+// are the command line flags with cfg applied, the flags themselves aren't
+// modified.
+func (l *liveInstance) apply(cfg *Config) ([]string, error) {
+	l.applyMtx.Lock()
+	defer l.applyMtx.Unlock()
+
+	s := commandLine
+	inst, err := newExporterFromConfig(&s, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _, old := l.current()
+	if old == nil {
+		old = &Config{}
+	}
+	changes := diffFlags(current.settings.values(), s.values(), s.separator)
+	if !reflect.DeepEqual(old.TLS, cfg.TLS) {
+		changes = append(changes, "tls: changed")
+	}
+	if !reflect.DeepEqual(old.MetricDescriptions, cfg.MetricDescriptions) {
+		changes = append(changes, "metric_descriptions: changed")
+	}
+	l.replace(inst, cfg)
+	return changes, nil
+}
+
+// values returns the values of s by flag name.
+func (s *settings) values() map[string]string {
+	// register points the flags at the fields of v, setting them to their
+	// defaults, before v is set to s
+	v := &settings{}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	v.register(fs)
+	*v = *s
+	values := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	// the targets of the config file are shown as redis.addr
+	if addrs, passwords := s.targets(); len(s.targetAddrs) > 0 {
+		values["redis.addr"] = strings.Join(addrs, s.separator)
+		values["redis.password"] = strings.Join(passwords, "\n")
+	}
+	return values
+}
+
+// diffFlags returns the flags whose values differ between before and after
+// as "name: old -> new", sorted by name. Passwords are redacted, the
+// addresses of redis.addr are split by separator to redact them.
+func diffFlags(before, after map[string]string, separator string) []string {
+	changes := []string{}
+	for name, val := range after {
+		if before[name] == val {
+			continue
+		}
+		old := before[name]
+		if strings.Contains(name, "password") {
+			old, val = "<redacted>", "<redacted>"
+		} else if name == "redis.addr" {
+			old = strings.Join(redactAddrs(strings.Split(old, separator)), separator)
+			val = strings.Join(redactAddrs(strings.Split(val, separator)), separator)
+		}
+		changes = append(changes, fmt.Sprintf("%s: %q -> %q", name, old, val))
+	}
+	sort.Strings(changes)
+	return changes
+}
@@ -2,27 +2,212 @@ package main
 
 import (
 	"flag"
-	"net/http"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/oliver006/redis_exporter/exporter"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
+// settings are the values of the flags, the config file fills in the ones
+// that weren't passed on the command line, see applyConfig.
+type settings struct {
+	redisAddr     string
+	redisPassword string
+	// targetAddrs and targetPasswords are the targets of the config file,
+	// they take the place of redisAddr and redisPassword. A nil
+	// targetPasswords means redisPassword applies to them.
+	targetAddrs      []string
+	targetPasswords  []string
+	dialTimeout      time.Duration
+	keepAlive        time.Duration
+	resetAfter       int
+	failover         bool
+	discoverRepl     bool
+	sentinelTargets  bool
+	sentinelReplicas bool
+	sentinelInterval time.Duration
+	namespace        string
+	namespaceMap     string
+	checkKeys        string
+	checkKeysFile    string
+	glob             bool
+	globLimit        int
+	memorySamples    int
+	bitmapKeys       string
+	geoKeys          string
+	labelKeys        string
+	hashKeys         string
+	hashTTLKeys      string
+	memberKeys       string
+	keyGroups        string
+	keyspaceSample   string
+	keyspaceLimit    int
+	keySizeBuckets   string
+	keyspaceTopN     int
+	keyspaceIdle     bool
+	scanCount        int
+	scanRate         float64
+	scanChunk        int
+	pipeline         bool
+	separator        string
+	scanAPILimit     int
+	maxScrapes       int
+	maxSeries        int
+	maxScrapeSeries  int
+	maxRespBytes     int
+	metricsAllowlist string
+	shardFlag        string
+	haLockFile       string
+	haLease          time.Duration
+	cacheTTL         time.Duration
+	keyCacheTTL      time.Duration
+	cmdStatsTopN     int
+	cmdStatsCommands string
+	dbAggregate      int
+	clusterTotals    bool
+	discoverFields   bool
+	slotSamples      int
+	waitReplicas     int
+	waitTimeout      time.Duration
+	monitorSample    time.Duration
+	debugObject      bool
+	minInterval      time.Duration
+	bgInterval       time.Duration
+	bgJitter         float64
+	rateWindow       time.Duration
+	deltas           bool
+	tlsServerName    string
+	tlsMinVersion    string
+	listenAddress    string
+	socketMode       string
+	webTLSCert       string
+	webTLSKey        string
+	webClientCA      string
+	allowedTargets   string
+	allowedSources   string
+	configAPI        bool
+	targetsAPI       bool
+	tracingEndpoint  string
+	tracingService   string
+	tracingRatio     float64
+	metricPath       string
+	isDebug          bool
+	logFormat        string
+	logFormatOld     string
+	logLevel         string
+	showVersion      bool
+	configFile       string
+	replayDir        string
+	dumpInfo         bool
+}
+
+// register defines the flags of s in fs.
+func (s *settings) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.redisAddr, "redis.addr", getEnv("REDIS_ADDR", "redis://localhost:6379"), "Address of one or more redis nodes, separated by separator")
+	fs.StringVar(&s.redisPassword, "redis.password", getEnv("REDIS_PASSWORD", ""), "Password for one or more redis nodes, separated by separator")
+	fs.DurationVar(&s.dialTimeout, "redis.dial-timeout", 0, "Timeout for connecting to redis nodes, 0 means no timeout")
+	fs.DurationVar(&s.keepAlive, "redis.keepalive", 5*time.Minute, "Interval of TCP keepalive probes of redis connections, negative values disable keepalive")
+	fs.IntVar(&s.resetAfter, "redis.reset-after-failures", 0, "Reset the state kept about a redis node (cached results, INFO features, SCAN cursors, discovered replicas) after that many failed scrapes of it in a row, 0 never resets it")
+	fs.BoolVar(&s.failover, "redis.failover", false, "Treat the addresses of --redis.addr as a prioritized failover list of a single instance and only scrape the first reachable one")
+	fs.BoolVar(&s.discoverRepl, "redis.discover-replicas", false, "Also scrape the replicas listed in the INFO replication section of every scraped master")
+	fs.BoolVar(&s.sentinelTargets, "sentinel.register-targets", false, "Register the masters monitored by the sentinels among the redis nodes as targets of /sd and /scrape, following failovers")
+	fs.BoolVar(&s.sentinelReplicas, "sentinel.register-replicas", false, "Also register the replicas of the masters monitored by sentinel, see --sentinel.register-targets")
+	fs.DurationVar(&s.sentinelInterval, "sentinel.register-interval", 30*time.Second, "How often the sentinels are asked for the nodes they monitor, see --sentinel.register-targets")
+	fs.StringVar(&s.namespace, "namespace", "redis", "Namespace for metrics")
+	fs.StringVar(&s.namespaceMap, "namespace-map", "", "Comma separated list of <redis addr>=<namespace> to export the metrics of these nodes under a different namespace, e.g. redis://a:6379=cache,redis://b:6379=sessions")
+	fs.StringVar(&s.checkKeys, "check-keys", "", "Comma separated list of keys to export value and length/size, e.g. db3=user_count. Prefix the db with a redis address (redis://host:6379/db3=user_count) to only check the key on that node")
+	fs.StringVar(&s.checkKeysFile, "check-keys-file", "", "File with one check-keys entry per line, reloaded on SIGHUP. Used in addition to --check-keys")
+	fs.BoolVar(&s.glob, "check-keys-glob", false, "Treat check-keys entries containing *, ? or [ as patterns and check the keys matching them, found via SCAN")
+	fs.IntVar(&s.globLimit, "check-keys-glob-limit", 1000, "Maximum number of keys checked per check-keys pattern, see --check-keys-glob")
+	fs.IntVar(&s.memorySamples, "check-keys-memory-samples", 5, "Number of elements of collections MEMORY USAGE samples for the memory usage of checked keys, 0 samples all elements")
+	fs.StringVar(&s.bitmapKeys, "check-bitmap-keys", "", "Comma separated list of bitmap keys to export the number of set bits of, same format as --check-keys")
+	fs.StringVar(&s.geoKeys, "check-geo-keys", "", "Comma separated list of geo keys to export the number of members of, same format as --check-keys. Append @<lon>:<lat>:<radius><unit> to also count the members within that radius")
+	fs.StringVar(&s.labelKeys, "check-value-label-keys", "", "Comma separated list of keys with categorical string values (e.g. feature flags) to export as label of key_value_info, same format as --check-keys")
+	fs.StringVar(&s.hashKeys, "check-hash-field-keys", "", "Comma separated list of hashes whose numeric fields are exported as key_hash_field_value, same format as --check-keys")
+	fs.StringVar(&s.hashTTLKeys, "check-hash-field-ttl-keys", "", "Comma separated list of hashes to export the TTLs of the listed fields of (redis 7.4) as key_hash_field_ttl_seconds, e.g. db0=session:42@token:refresh")
+	fs.StringVar(&s.memberKeys, "check-member-pattern-keys", "", "Comma separated list of sets and sorted sets to export the number of members matching a pattern of as key_members_matching, e.g. db0=jobs@failed:*")
+	fs.StringVar(&s.keyGroups, "count-key-groups", "", "Count the keys and their memory usage per prefix by SCANning the db, e.g. db0=user:,session:;db3=cache:")
+	fs.StringVar(&s.keyspaceSample, "keyspace-sample", "", "SCAN these dbs on every scrape, e.g. db0,db3, and export the distribution of the memory usage of the keys as keyspace_key_memory_bytes histogram")
+	fs.IntVar(&s.keyspaceLimit, "keyspace-sample.limit", 10000, "Maximum number of keys sampled per db and scrape, see --keyspace-sample")
+	fs.StringVar(&s.keySizeBuckets, "keyspace-sample.buckets", "", "Comma separated buckets of keyspace_key_memory_bytes in bytes, defaults to powers of 4 from 64 to 16MiB")
+	fs.IntVar(&s.keyspaceTopN, "keyspace-sample.top-n", 0, "Also export the N biggest sampled keys of every db as biggest_key_bytes, see --keyspace-sample")
+	fs.BoolVar(&s.keyspaceIdle, "keyspace-sample.idle-time", false, "Also export the distribution of the OBJECT IDLETIME of the sampled keys as keyspace_key_idle_seconds histogram, see --keyspace-sample")
+	fs.IntVar(&s.scanCount, "scan-count", 1000, "COUNT hint of SCAN calls, lower values block busy redis nodes for a shorter time per call but make scrapes take longer")
+	fs.Float64Var(&s.scanRate, "scan-keys-per-second", 0, "Maximum number of keys per second all SCANs of the keyspace together look at, pacing them on latency sensitive nodes. 0 means no limit")
+	fs.IntVar(&s.scanChunk, "scan-chunk", 0, "Spread the --count-key-groups SCANs over several scrapes, looking at about this many keys per db and scrape and resuming from the saved cursor. 0 SCANs the whole db on every scrape")
+	fs.BoolVar(&s.pipeline, "pipeline", false, "Pipeline the CONFIG GET and key check commands of a scrape instead of sending them one by one, saving round trips to distant redis nodes")
+	fs.StringVar(&s.separator, "separator", ",", "separator used to split redis.addr and redis.password into several elements.")
+	fs.IntVar(&s.scanAPILimit, "api.scan-limit", 10000, "Maximum number of keys looked at by a single POST /api/scan request")
+	fs.IntVar(&s.maxScrapes, "max-concurrent-scrapes", 0, "Maximum number of redis nodes scraped at the same time, 0 means no limit")
+	fs.IntVar(&s.maxSeries, "max-series-per-target", 0, "Maximum number of series exported per redis node, the overflow is dropped and counted in exporter_series_dropped_total. 0 means no limit")
+	fs.IntVar(&s.maxScrapeSeries, "max-series-per-scrape", 0, "Maximum number of series served per scrape of /metrics or /scrape, the overflow is dropped and exporter_scrape_truncated set to 1. 0 means no limit")
+	fs.IntVar(&s.maxRespBytes, "max-response-bytes", 0, "Maximum size of the metrics served per scrape in bytes of the text format, the overflow is dropped and exporter_scrape_truncated set to 1. 0 means no limit")
+	fs.StringVar(&s.metricsAllowlist, "metrics.allowlist-file", "", "File of the metric names (one per line, including the namespace) served on /metrics and /scrape, all other metrics are dropped. Empty serves all metrics")
+	fs.StringVar(&s.shardFlag, "shard", "", "Only scrape the part <index>/<total> of the targets, e.g. 2/5, to split the same target list across several exporter replicas")
+	fs.StringVar(&s.haLockFile, "ha.lock-file", "", "Elect a leader among exporter replicas sharing this lock file, only the leader runs the key group SCANs, the WAIT probe and MONITOR sampling")
+	fs.DurationVar(&s.haLease, "ha.lease-duration", 15*time.Second, "How long the lease of the leader in --ha.lock-file is valid without being renewed")
+	fs.DurationVar(&s.cacheTTL, "cache-ttl", 0, "How long to serve cached results of a redis node before scraping it again, 0 disables caching")
+	fs.DurationVar(&s.keyCacheTTL, "key-cache-ttl", 0, "How long to reuse the key checks and key group and keyspace sample SCANs of a redis node before running them again, 0 runs them on every scrape")
+	fs.IntVar(&s.cmdStatsTopN, "command-stats-top-n", 0, "Only export per command metrics of the N most called commands, the rest is summed up as cmd=\"other\". 0 exports all commands")
+	fs.StringVar(&s.cmdStatsCommands, "command-stats-commands", "", "Comma separated commands (e.g. get,set,hget) whose per command metrics are exported, the rest is summed up as cmd=\"other\". Empty exports all commands")
+	fs.IntVar(&s.dbAggregate, "db-aggregate-threshold", 0, "Sum up the keyspace metrics of all databases with an index >= N as db=\"other\", 0 disables aggregation")
+	fs.BoolVar(&s.clusterTotals, "cluster-keyspace-totals", false, "Also export the keyspace metrics summed up across all scraped cluster masters as cluster_db_keys")
+	fs.BoolVar(&s.discoverFields, "discover-info-fields", false, "Also export the numeric INFO fields the exporter doesn't know (e.g. of newer redis versions) as info_<field>")
+	fs.IntVar(&s.slotSamples, "cluster-slot-samples", 0, "Number of slots per cluster master whose keys are counted per scrape to export the distribution of keys across slots, 0 disables it")
+	fs.IntVar(&s.waitReplicas, "wait-probe-replicas", 0, "Write a probe key to every master and WAIT for this many replicas to acknowledge it, exporting how many did and how long it took. 0 disables the probe")
+	fs.DurationVar(&s.waitTimeout, "wait-probe-timeout", time.Second, "Maximum time the WAIT probe waits for replicas")
+	fs.DurationVar(&s.monitorSample, "monitor-sample-duration", 0, "Attach MONITOR to every redis node for this long per scrape and export the observed command mix and key prefixes. Expensive for redis, 0 disables it")
+	fs.BoolVar(&s.debugObject, "check-keys-debug-object", false, "On redis versions without MEMORY USAGE, use the serializedlength of DEBUG OBJECT as memory usage of checked keys")
+	fs.DurationVar(&s.minInterval, "min-scrape-interval", 0, "Minimum time between two scrapes of the same redis node, faster requests get cached results")
+	fs.DurationVar(&s.bgInterval, "background-scrape-interval", 0, "Scrape the redis nodes in the background every interval and serve the latest results, spreading the nodes over the interval. 0 scrapes on every request")
+	fs.Float64Var(&s.bgJitter, "background-scrape-jitter", 0.1, "Fraction of --background-scrape-interval every background scrape interval is randomly shortened or prolonged by, 0 to 1")
+	fs.DurationVar(&s.rateWindow, "rate-window", 0, "Also export per second rates of some counters, e.g. commands_processed_per_second, averaged over this window, for sinks without rate(). 0 disables them")
+	fs.BoolVar(&s.deltas, "deltas", false, "Export counters as their increase since the previous scrape instead of their cumulative value, for push based sinks expecting deltas")
+	fs.StringVar(&s.tlsServerName, "tls-server-name", "", "Name to verify the certificate of rediss:// nodes against and to send via SNI, instead of the host of the address")
+	fs.StringVar(&s.tlsMinVersion, "tls-min-version", "", "Minimum TLS version used for rediss:// nodes, valid options are 1.0, 1.1, 1.2 and 1.3")
+	fs.StringVar(&s.listenAddress, "web.listen-address", ":9121", "Address to listen on for web interface and telemetry.")
+	fs.StringVar(&s.socketMode, "web.socket-mode", "0660", "Permissions of the Unix domain socket if --web.listen-address is unix:///path/to.sock")
+	fs.StringVar(&s.webTLSCert, "web.tls-cert-file", "", "Certificate to serve the web interface and telemetry via HTTPS with")
+	fs.StringVar(&s.webTLSKey, "web.tls-key-file", "", "Key of --web.tls-cert-file")
+	fs.StringVar(&s.webClientCA, "web.tls-client-ca-file", "", "CA certificates to verify the client certificates of scrapers against, requests without a valid client certificate are rejected")
+	fs.StringVar(&s.allowedTargets, "scrape.allowed-targets", "", "Comma separated CIDRs, host patterns (e.g. *.cache.internal) and target patterns (e.g. redis://*.cache.internal:6379) /scrape may connect to besides the configured nodes, empty allows all")
+	fs.StringVar(&s.allowedSources, "web.allowed-sources", "", "Comma separated CIDRs and IPs of the clients allowed to connect to the web interface, empty allows all")
+	fs.BoolVar(&s.configAPI, "web.enable-config-api", false, "Serve POST /api/config to apply a new config at runtime, requires --web.tls-client-ca-file or --web.allowed-sources unless listening on a Unix domain socket")
+	fs.BoolVar(&s.targetsAPI, "web.enable-targets-api", false, "Serve /api/targets/register to register targets at runtime, requires --web.tls-client-ca-file or --web.allowed-sources unless listening on a Unix domain socket")
+	fs.StringVar(&s.tracingEndpoint, "tracing.otlp-endpoint", "", "OTLP/HTTP endpoint of an OpenTelemetry collector the traces of the scrapes are sent to, e.g. http://otel-collector:4318. Empty disables tracing")
+	fs.StringVar(&s.tracingService, "tracing.service-name", "redis_exporter", "service.name of the traces, see --tracing.otlp-endpoint")
+	fs.Float64Var(&s.tracingRatio, "tracing.sample-ratio", 1, "Fraction of the scrapes traced (0 to 1), see --tracing.otlp-endpoint")
+	fs.StringVar(&s.metricPath, "web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+	fs.BoolVar(&s.isDebug, "debug", false, "Output verbose debug information, same as --log.level=debug")
+	fs.StringVar(&s.logFormat, "log.format", "txt", "Log format, valid options are txt and json")
+	fs.StringVar(&s.logFormatOld, "log-format", "", "Deprecated, use --log.format")
+	fs.StringVar(&s.logLevel, "log.level", "info", "Only log messages with the given severity or above, valid options are debug, info, warn, error and fatal")
+	fs.BoolVar(&s.showVersion, "version", false, "Show version information and exit")
+	fs.StringVar(&s.configFile, "config.file", "", "Path to a YAML config file, flags passed on the command line take precedence over it")
+	fs.StringVar(&s.replayDir, "replay.dir", "", "Serve the metrics of recorded INFO responses instead of scraping redis, every file in this directory is a target. --redis.addr is ignored")
+	fs.BoolVar(&s.dumpInfo, "debug.dump-info", false, "Print the INFO response of all redis nodes and how each line is mapped to metrics, then exit")
+}
+
+func init() {
+	flags.register(flag.CommandLine)
+}
+
 var (
-	redisAddr     = flag.String("redis.addr", getEnv("REDIS_ADDR", "redis://localhost:6379"), "Address of one or more redis nodes, separated by separator")
-	redisPassword = flag.String("redis.password", getEnv("REDIS_PASSWORD", ""), "Password for one or more redis nodes, separated by separator")
-	namespace     = flag.String("namespace", "redis", "Namespace for metrics")
-	checkKeys     = flag.String("check-keys", "", "Comma separated list of keys to export value and length/size")
-	separator     = flag.String("separator", ",", "separator used to split redis.addr and redis.password into several elements.")
-	listenAddress = flag.String("web.listen-address", ":9121", "Address to listen on for web interface and telemetry.")
-	metricPath    = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-	isDebug       = flag.Bool("debug", false, "Output verbose debug information")
-	logFormat     = flag.String("log-format", "txt", "Log format, valid options are txt and json")
-	showVersion   = flag.Bool("version", false, "Show version information and exit")
+	// flags are the settings the exporter was started with: the command
+	// line, and the config file once newExporter applied it
+	flags settings
+	// commandLine are the flags as passed on the command line, without the
+	// config file
+	commandLine settings
 
 	// VERSION, BUILD_DATE, GIT_COMMIT are filled in by the CircleCI build
 	VERSION     = "<<< filled in by build >>>"
@@ -30,64 +215,636 @@ var (
 	COMMIT_SHA1 = "<<< filled in by build >>>"
 )
 
+// command is a subcommand of redis_exporter. All commands share the global
+// flags and the config file, flags adds command specific ones.
+type command struct {
+	help  string
+	flags func()
+	run   func() int
+}
+
+var commands = map[string]command{
+	"serve":        {help: "Serve metrics via HTTP (default)", run: serve},
+	"check-config": {help: "Validate the file passed via --config.file and exit", run: runCheckConfig},
+	"scrape-once":  {help: "Scrape all redis nodes once and print the metrics to stdout", flags: scrapeOnceFlags, run: scrapeOnce},
+	"scan-keys":    {help: "SCAN a redis node for keys matching --scan.pattern and print them", flags: scanKeysFlags, run: scanKeys},
+	"analyze-rdb":  {help: "Print keyspace statistics of the RDB dump --rdb.file", flags: analyzeRDBFlags, run: analyzeRDB},
+	"healthcheck":  {help: "Exit 0 if the local exporter is healthy, 1 otherwise", flags: healthcheckFlags, run: healthcheck},
+	"version":      {help: "Show version information and exit", run: printVersion},
+}
+
 func main() {
-	flag.Parse()
-	switch *logFormat {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	flag.Usage = usage
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if cmd.flags != nil {
+		cmd.flags()
+	}
+	flag.CommandLine.Parse(args)
+	commandLine = flags
+
+	if flags.logFormatOld != "" {
+		flags.logFormat = flags.logFormatOld
+	}
+	switch flags.logFormat {
 	case "json":
 		log.SetFormatter(&log.JSONFormatter{})
 	default:
 		log.SetFormatter(&log.TextFormatter{})
 	}
-	log.Printf("Redis Metrics Exporter %s    build date: %s    sha1: %s\n", VERSION, BUILD_DATE, COMMIT_SHA1)
-	if *isDebug {
-		log.SetLevel(log.DebugLevel)
-		log.Debugln("Enabling debug output")
-	} else {
-		log.SetLevel(log.InfoLevel)
+	level, err := log.ParseLevel(flags.logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --log.level: %s\n", err)
+		os.Exit(2)
+	}
+	if flags.isDebug {
+		level = log.DebugLevel
 	}
+	log.SetLevel(level)
+	log.Debugln("Enabling debug output")
 
-	if *showVersion {
+	if flags.showVersion {
+		cmd = commands["version"]
+	}
+	if name == "serve" && runAsService() {
 		return
 	}
+	os.Exit(cmd.run())
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	addrs := strings.Split(*redisAddr, *separator)
-	passwords := strings.Split(*redisPassword, *separator)
+// newExporter creates the exporter instance of the flags and the config
+// file, the config (nil without --config.file) is returned for setting up
+// the additional instances it may define.
+func newExporter() (*instance, *Config, error) {
+	var cfg *Config
+	if flags.configFile != "" {
+		var err error
+		if cfg, err = loadConfig(flags.configFile); err != nil {
+			return nil, nil, err
+		}
+		if errs := cfg.validate(); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("%s: %s", flags.configFile, errs[0])
+		}
+	}
+	inst, err := newExporterFromConfig(&flags, cfg)
+	return inst, cfg, err
+}
+
+// newExporterFromConfig creates the exporter instance of the flags, the
+// settings of cfg (which may be nil) are applied to all flags that weren't
+// passed on the command line first.
+func newExporterFromConfig(s *settings, cfg *Config) (*instance, error) {
+	var tlsSettings TLSConfig
+	var metricHelp, metricDocURLs map[string]string
+	if cfg != nil {
+		s.applyConfig(cfg)
+		metricHelp, metricDocURLs = cfg.metricDescriptions(s.namespace)
+		tlsSettings = cfg.TLS
+	}
+	tlsSettings.ServerName, tlsSettings.MinVersion = s.tlsServerName, s.tlsMinVersion
+	tlsConfig, err := tlsSettings.build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+
+	addrs, passwords := s.targets()
+	if s.replayDir != "" {
+		files, err := replayFiles(s.replayDir)
+		if err != nil {
+			return nil, err
+		}
+		addrs, passwords = files, []string{""}
+	}
 	for len(passwords) < len(addrs) {
 		passwords = append(passwords, passwords[0])
 	}
+	sh, err := parseShard(s.shardFlag)
+	if err != nil {
+		return nil, fmt.Errorf("shard: %s", err)
+	}
+	if sh.total > 1 {
+		all := len(addrs)
+		addrs, passwords = sh.filter(addrs, passwords)
+		log.Printf("Scraping %d of %d targets as shard %d/%d", len(addrs), all, sh.index, sh.total)
+	}
 
-	exp, err := exporter.NewRedisExporter(
-		exporter.RedisHost{Addrs: addrs, Passwords: passwords},
-		*namespace,
-		*checkKeys)
+	keys, err := s.allCheckKeys()
+	if err != nil {
+		return nil, err
+	}
+	nsMap, err := exporter.ParseNamespaceMap(s.namespaceMap)
+	if err != nil {
+		return nil, fmt.Errorf("namespace-map: %s", err)
+	}
+	if s.keyspaceTopN < 0 {
+		return nil, fmt.Errorf("keyspace-sample.top-n: must not be negative")
+	}
+	buckets, err := exporter.ParseBuckets(s.keySizeBuckets)
+	if err != nil {
+		return nil, fmt.Errorf("keyspace-sample.buckets: %s", err)
+	}
+
+	opts := exporter.Options{
+		Namespace:              s.namespace,
+		NamespaceMap:           nsMap,
+		CheckKeys:              keys,
+		CheckKeysGlob:          s.glob,
+		CheckKeysGlobLimit:     s.globLimit,
+		CheckBitmapKeys:        s.bitmapKeys,
+		CheckGeoKeys:           s.geoKeys,
+		CheckValueLabelKeys:    s.labelKeys,
+		CheckHashFieldKeys:     s.hashKeys,
+		CheckHashFieldTTLKeys:  s.hashTTLKeys,
+		CheckMemberPatternKeys: s.memberKeys,
+		CountKeyGroups:         s.keyGroups,
+		KeyspaceSample:         s.keyspaceSample,
+		KeyspaceSampleLimit:    s.keyspaceLimit,
+		KeySizeBuckets:         buckets,
+		KeyspaceTopN:           s.keyspaceTopN,
+		KeyspaceIdleTime:       s.keyspaceIdle,
+		ScanCount:              s.scanCount,
+		ScanThrottle:           exporter.NewScanThrottle(s.scanRate),
+		ScanChunk:              s.scanChunk,
+		Pipeline:               s.pipeline,
+		KeyMemorySamples:       s.memorySamplesOption(),
+		Dialer:                 &net.Dialer{Timeout: s.dialTimeout, KeepAlive: s.keepAlive},
+		ResetAfterFailures:     s.resetAfter,
+		Failover:               s.failover,
+		DiscoverReplicas:       s.discoverRepl,
+		MetricHelp:             metricHelp,
+		MetricDocURLs:          metricDocURLs,
+		MaxSeriesPerTarget:     s.maxSeries,
+		Replay:                 s.replayDir != "",
+		Limiter:                exporter.NewScrapeLimiter(s.maxScrapes),
+		CacheTTL:               s.cacheTTL,
+		KeyCacheTTL:            s.keyCacheTTL,
+		MinScrapeInterval:      s.minInterval,
+		ScrapeInterval:         s.bgInterval,
+		ScrapeJitter:           s.bgJitter,
+		RateWindow:             s.rateWindow,
+		Deltas:                 s.deltas,
+		TLSConfig:              tlsConfig,
+		CommandStatsTopN:       s.cmdStatsTopN,
+		CommandStatsCommands:   exporter.ParseCommands(s.cmdStatsCommands),
+		DBAggregateThreshold:   s.dbAggregate,
+		ClusterKeyspaceTotals:  s.clusterTotals,
+		DiscoverInfoFields:     s.discoverFields,
+		ClusterSlotSamples:     s.slotSamples,
+		WaitProbeReplicas:      s.waitReplicas,
+		WaitProbeTimeout:       s.waitTimeout,
+		MonitorSampleDuration:  s.monitorSample,
+		KeyDebugObjectFallback: s.debugObject,
+	}
+	if s.bgJitter < 0 || s.bgJitter >= 1 {
+		return nil, fmt.Errorf("background-scrape-jitter: must be at least 0 and less than 1")
+	}
+	if s.haLockFile != "" {
+		if s.haLease <= 0 {
+			return nil, fmt.Errorf("ha.lease-duration: must be positive")
+		}
+		opts.Leader = leaderElection(s).isLeader
+	}
+	if cfg != nil {
+		if vault := newVaultProvider(cfg); vault != nil {
+			opts.Credentials = vault
+		}
+		opts.MinimalTargets = cfg.minimalTargets()
+		opts.TargetTimeouts = cfg.targetTimeouts()
+	}
+	if s.tracingEndpoint != "" {
+		if opts.Tracer, err = exporter.NewTracer(s.tracingEndpoint, s.tracingService, s.tracingRatio); err != nil {
+			return nil, fmt.Errorf("tracing: %s", err)
+		}
+	}
+
+	allowlist, err := parseTargetAllowlist(strings.Split(s.allowedTargets, ","))
+	if err != nil {
+		return nil, fmt.Errorf("scrape.allowed-targets: %s", err)
+	}
+	inst, err := newInstance("", addrs, passwords, opts, s)
+	if err != nil {
+		return nil, err
+	}
+	inst.allowlist = allowlist
+	if cfg != nil {
+		inst.aliases, inst.modules = cfg.aliases(), cfg.Modules
+	}
+	return inst, nil
+}
+
+func serve() int {
+	log.Printf("Redis Metrics Exporter %s    build date: %s    sha1: %s\n", VERSION, BUILD_DATE, COMMIT_SHA1)
+
+	inst, cfg, err := newExporter()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.dumpInfo {
+		for _, addr := range inst.addrs {
+			if err := inst.exp.DumpInfo(addr, os.Stdout); err != nil {
+				log.Errorf("couldn't dump INFO of %s, err: %s", exporter.LabelAddr(addr), err)
+				return 1
+			}
+		}
+		return 0
+	}
+
+	if err := flags.checkAPI("web.enable-config-api", flags.configAPI, "change its config"); err != nil {
+		log.Fatal(err)
+	}
+	if err := flags.checkAPI("web.enable-targets-api", flags.targetsAPI, "register targets and their passwords"); err != nil {
+		log.Fatal(err)
+	}
+	live := newLiveInstance(inst, cfg, flags.configAPI)
+	if err := inst.register(live); err != nil {
+		log.Fatal(err)
+	}
+	if flags.haLockFile != "" {
+		if err := inst.registerer.Register(leaderElection(&flags).collector()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	web, err := newWebServer()
 	if err != nil {
 		log.Fatal(err)
 	}
-	prometheus.MustRegister(exp)
-
-	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "redis_exporter_build_info",
-		Help: "redis exporter build_info",
-	}, []string{"version", "commit_sha", "build_date", "golang_version"})
-	prometheus.MustRegister(buildInfo)
-	buildInfo.WithLabelValues(VERSION, COMMIT_SHA1, BUILD_DATE, runtime.Version()).Set(1)
-
-	http.Handle(*metricPath, prometheus.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-<html>
-<head><title>Redis Exporter v` + VERSION + `</title></head>
-<body>
-<h1>Redis Exporter v` + VERSION + `</h1>
-<p><a href='` + *metricPath + `'>Metrics</a></p>
-</body>
-</html>
-						`))
-	})
-
-	log.Printf("Providing metrics at %s%s", *listenAddress, *metricPath)
-	log.Printf("Connecting to redis hosts: %#v", addrs)
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	listener, err := web.listen(flags.listenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg != nil {
+		for _, ic := range cfg.Instances {
+			extra, err := ic.newInstance(inst.settings, inst.opts, cfg.aliases())
+			if err != nil {
+				log.Fatalf("instances.%s: %s", ic.Name, err)
+			}
+			extra.modules, extra.allowlist = cfg.Modules, inst.allowlist
+			go serveInstance(extra, ic.ListenAddress, web)
+		}
+	}
+
+	log.Printf("Providing metrics at %s%s", flags.listenAddress, flags.metricPath)
+	log.Printf("Connecting to redis hosts: %#v", redactAddrs(inst.addrs))
+	if err := sdNotify("READY=1"); err != nil {
+		log.Warnf("Couldn't notify systemd, err: %s", err)
+	}
+	go sdWatchdog(live.exporter)
+	if flags.sentinelTargets {
+		if flags.sentinelInterval <= 0 {
+			log.Fatal("sentinel.register-interval: must be positive")
+		}
+		go registerSentinelNodes(live.instance)
+	}
+	if flags.checkKeysFile != "" {
+		go reloadCheckKeysOnHUP(live.instance)
+	}
+	if err := web.serve(listener, live); err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
+
+// serveInstance serves the additional instance inst on listenAddress.
+func serveInstance(inst *instance, listenAddress string, web webServer) {
+	if err := inst.register(inst.exp); err != nil {
+		log.Fatalf("instances.%s: %s", inst.name, err)
+	}
+	listener, err := web.listen(listenAddress)
+	if err != nil {
+		log.Fatalf("instances.%s: %s", inst.name, err)
+	}
+	inst.startBackground()
+	log.Printf("Providing metrics of instance %s at %s%s, redis hosts: %#v", inst.name, listenAddress, flags.metricPath, redactAddrs(inst.addrs))
+	if err := web.serve(listener, inst.handler()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// webTLSSettings returns the HTTPS settings of the web interface.
+func webTLSSettings() WebTLSConfig {
+	return WebTLSConfig{CertFile: flags.webTLSCert, KeyFile: flags.webTLSKey, ClientCAFile: flags.webClientCA}
+}
+
+// newWebServer returns the settings of the web interface given by the flags.
+func newWebServer() (webServer, error) {
+	var web webServer
+	var err error
+	if web.mode, err = parseSocketMode(flags.socketMode); err != nil {
+		return web, fmt.Errorf("web.socket-mode: %s", err)
+	}
+	if web.tls, err = webTLSSettings().build(); err != nil {
+		return web, fmt.Errorf("web.tls: %s", err)
+	}
+	if web.sources, err = parseSourceAllowlist(strings.Split(flags.allowedSources, ",")); err != nil {
+		return web, fmt.Errorf("web.allowed-sources: %s", err)
+	}
+	return web, nil
+}
+
+func printVersion() int {
+	fmt.Printf("Redis Metrics Exporter %s    build date: %s    sha1: %s    go: %s\n", VERSION, BUILD_DATE, COMMIT_SHA1, runtime.Version())
+	return 0
+}
+
+// applyConfig copies the settings of cfg into all flags that
+// weren't explicitly passed on the command line.
+func (s *settings) applyConfig(cfg *Config) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if !set["web.allowed-sources"] && len(cfg.WebAllowedSources) > 0 {
+		s.allowedSources = strings.Join(cfg.WebAllowedSources, ",")
+	}
+	if !set["tracing.otlp-endpoint"] && cfg.Tracing.OTLPEndpoint != "" {
+		s.tracingEndpoint = cfg.Tracing.OTLPEndpoint
+	}
+	if !set["tracing.service-name"] && cfg.Tracing.ServiceName != "" {
+		s.tracingService = cfg.Tracing.ServiceName
+	}
+	if !set["tracing.sample-ratio"] && cfg.Tracing.SampleRatio > 0 {
+		s.tracingRatio = cfg.Tracing.SampleRatio
+	}
+	if !set["scrape.allowed-targets"] && len(cfg.ScrapeAllowedTargets) > 0 {
+		s.allowedTargets = strings.Join(cfg.ScrapeAllowedTargets, ",")
+	}
+	if !set["web.tls-cert-file"] && cfg.WebTLS.CertFile != "" {
+		s.webTLSCert = cfg.WebTLS.CertFile
+	}
+	if !set["web.tls-key-file"] && cfg.WebTLS.KeyFile != "" {
+		s.webTLSKey = cfg.WebTLS.KeyFile
+	}
+	if !set["web.tls-client-ca-file"] && cfg.WebTLS.ClientCAFile != "" {
+		s.webClientCA = cfg.WebTLS.ClientCAFile
+	}
+
+	if !set["namespace"] && cfg.Namespace != "" {
+		s.namespace = cfg.Namespace
+	}
+	if !set["namespace-map"] && len(cfg.NamespaceMap) > 0 {
+		var mappings []string
+		for addr, ns := range cfg.NamespaceMap {
+			mappings = append(mappings, addr+"="+ns)
+		}
+		sort.Strings(mappings)
+		s.namespaceMap = strings.Join(mappings, ",")
+	}
+	if !set["check-keys"] && len(cfg.CheckKeys) > 0 {
+		s.checkKeys = strings.Join(cfg.CheckKeys, ",")
+	}
+	if !set["tls-server-name"] && cfg.TLS.ServerName != "" {
+		s.tlsServerName = cfg.TLS.ServerName
+	}
+	if !set["tls-min-version"] && cfg.TLS.MinVersion != "" {
+		s.tlsMinVersion = cfg.TLS.MinVersion
+	}
+	if !set["check-keys-file"] && cfg.CheckKeysFile != "" {
+		s.checkKeysFile = cfg.CheckKeysFile
+	}
+	if !set["check-keys-glob"] && cfg.CheckKeysGlob {
+		s.glob = true
+	}
+	if !set["check-keys-glob-limit"] && cfg.CheckKeysGlobLimit > 0 {
+		s.globLimit = cfg.CheckKeysGlobLimit
+	}
+	if !set["check-bitmap-keys"] && len(cfg.CheckBitmapKeys) > 0 {
+		s.bitmapKeys = strings.Join(cfg.CheckBitmapKeys, ",")
+	}
+	if !set["check-geo-keys"] && len(cfg.CheckGeoKeys) > 0 {
+		s.geoKeys = strings.Join(cfg.CheckGeoKeys, ",")
+	}
+	if !set["check-value-label-keys"] && len(cfg.CheckValueLabelKeys) > 0 {
+		s.labelKeys = strings.Join(cfg.CheckValueLabelKeys, ",")
+	}
+	if !set["check-hash-field-keys"] && len(cfg.CheckHashFieldKeys) > 0 {
+		s.hashKeys = strings.Join(cfg.CheckHashFieldKeys, ",")
+	}
+	if !set["check-hash-field-ttl-keys"] && len(cfg.CheckHashFieldTTLKeys) > 0 {
+		s.hashTTLKeys = strings.Join(cfg.CheckHashFieldTTLKeys, ",")
+	}
+	if !set["check-member-pattern-keys"] && len(cfg.CheckMemberPatternKeys) > 0 {
+		s.memberKeys = strings.Join(cfg.CheckMemberPatternKeys, ",")
+	}
+	if !set["pipeline"] && cfg.Pipeline {
+		s.pipeline = true
+	}
+	if !set["scan-chunk"] && cfg.ScanChunk > 0 {
+		s.scanChunk = cfg.ScanChunk
+	}
+	if !set["scan-keys-per-second"] && cfg.ScanKeysPerSecond > 0 {
+		s.scanRate = cfg.ScanKeysPerSecond
+	}
+	if !set["keyspace-sample"] && len(cfg.KeyspaceSample.DBs) > 0 {
+		s.keyspaceSample = strings.Join(cfg.KeyspaceSample.DBs, ",")
+	}
+	if !set["keyspace-sample.limit"] && cfg.KeyspaceSample.Limit > 0 {
+		s.keyspaceLimit = cfg.KeyspaceSample.Limit
+	}
+	if !set["keyspace-sample.top-n"] && cfg.KeyspaceSample.TopN > 0 {
+		s.keyspaceTopN = cfg.KeyspaceSample.TopN
+	}
+	if !set["keyspace-sample.idle-time"] && cfg.KeyspaceSample.IdleTime {
+		s.keyspaceIdle = true
+	}
+	if !set["keyspace-sample.buckets"] && len(cfg.KeyspaceSample.Buckets) > 0 {
+		var buckets []string
+		for _, b := range cfg.KeyspaceSample.Buckets {
+			buckets = append(buckets, strconv.FormatFloat(b, 'g', -1, 64))
+		}
+		s.keySizeBuckets = strings.Join(buckets, ",")
+	}
+	if !set["count-key-groups"] && len(cfg.CountKeyGroups) > 0 {
+		s.keyGroups = strings.Join(cfg.CountKeyGroups, ";")
+	}
+	if !set["check-keys-memory-samples"] && cfg.CheckKeysMemorySamples != nil {
+		s.memorySamples = *cfg.CheckKeysMemorySamples
+	}
+	if !set["redis.dial-timeout"] && cfg.DialTimeout > 0 {
+		s.dialTimeout = cfg.DialTimeout
+	}
+	if !set["redis.keepalive"] && cfg.KeepAlive != 0 {
+		s.keepAlive = cfg.KeepAlive
+	}
+	if !set["redis.reset-after-failures"] && cfg.ResetAfterFailures > 0 {
+		s.resetAfter = cfg.ResetAfterFailures
+	}
+	if !set["redis.failover"] && cfg.Failover {
+		s.failover = true
+	}
+	if !set["sentinel.register-targets"] && cfg.Sentinel.RegisterTargets {
+		s.sentinelTargets = true
+	}
+	if !set["sentinel.register-replicas"] && cfg.Sentinel.RegisterReplicas {
+		s.sentinelReplicas = true
+	}
+	if !set["sentinel.register-interval"] && cfg.Sentinel.RegisterInterval > 0 {
+		s.sentinelInterval = cfg.Sentinel.RegisterInterval
+	}
+	if !set["redis.discover-replicas"] && cfg.DiscoverReplicas {
+		s.discoverRepl = true
+	}
+	if !set["max-series-per-scrape"] && cfg.MaxSeriesPerScrape > 0 {
+		s.maxScrapeSeries = cfg.MaxSeriesPerScrape
+	}
+	if !set["max-response-bytes"] && cfg.MaxResponseBytes > 0 {
+		s.maxRespBytes = cfg.MaxResponseBytes
+	}
+	if !set["metrics.allowlist-file"] && cfg.MetricsAllowlistFile != "" {
+		s.metricsAllowlist = cfg.MetricsAllowlistFile
+	}
+	if !set["max-series-per-target"] && cfg.MaxSeriesPerTarget > 0 {
+		s.maxSeries = cfg.MaxSeriesPerTarget
+	}
+	if !set["scan-count"] && cfg.ScanCount > 0 {
+		s.scanCount = cfg.ScanCount
+	}
+	if !set["max-concurrent-scrapes"] && cfg.MaxConcurrentScrapes > 0 {
+		s.maxScrapes = cfg.MaxConcurrentScrapes
+	}
+	if !set["key-cache-ttl"] && cfg.KeyCacheTTL > 0 {
+		s.keyCacheTTL = cfg.KeyCacheTTL
+	}
+	if !set["cache-ttl"] && cfg.CacheTTL > 0 {
+		s.cacheTTL = cfg.CacheTTL
+	}
+	if !set["deltas"] && cfg.Deltas {
+		s.deltas = true
+	}
+	if !set["rate-window"] && cfg.RateWindow > 0 {
+		s.rateWindow = cfg.RateWindow
+	}
+	if !set["min-scrape-interval"] && cfg.MinScrapeInterval > 0 {
+		s.minInterval = cfg.MinScrapeInterval
+	}
+	if !set["background-scrape-interval"] && cfg.BackgroundScrapeInterval > 0 {
+		s.bgInterval = cfg.BackgroundScrapeInterval
+	}
+	if !set["background-scrape-jitter"] && cfg.BackgroundScrapeJitter > 0 {
+		s.bgJitter = cfg.BackgroundScrapeJitter
+	}
+	if !set["command-stats-top-n"] && cfg.CommandStatsTopN > 0 {
+		s.cmdStatsTopN = cfg.CommandStatsTopN
+	}
+	if !set["command-stats-commands"] && len(cfg.CommandStatsCommands) > 0 {
+		s.cmdStatsCommands = strings.Join(cfg.CommandStatsCommands, ",")
+	}
+	if !set["db-aggregate-threshold"] && cfg.DBAggregateThreshold > 0 {
+		s.dbAggregate = cfg.DBAggregateThreshold
+	}
+	if !set["cluster-keyspace-totals"] && cfg.ClusterKeyspaceTotals {
+		s.clusterTotals = true
+	}
+	if !set["discover-info-fields"] && cfg.DiscoverInfoFields {
+		s.discoverFields = true
+	}
+	if !set["cluster-slot-samples"] && cfg.ClusterSlotSamples > 0 {
+		s.slotSamples = cfg.ClusterSlotSamples
+	}
+	if !set["wait-probe-replicas"] && cfg.WaitProbeReplicas > 0 {
+		s.waitReplicas = cfg.WaitProbeReplicas
+	}
+	if !set["wait-probe-timeout"] && cfg.WaitProbeTimeout > 0 {
+		s.waitTimeout = cfg.WaitProbeTimeout
+	}
+	if !set["monitor-sample-duration"] && cfg.MonitorSampleDuration > 0 {
+		s.monitorSample = cfg.MonitorSampleDuration
+	}
+	if !set["check-keys-debug-object"] && cfg.CheckKeysDebugObject {
+		s.debugObject = true
+	}
+	if !set["ha.lock-file"] && cfg.HALockFile != "" {
+		s.haLockFile = cfg.HALockFile
+	}
+	if !set["ha.lease-duration"] && cfg.HALeaseDuration > 0 {
+		s.haLease = cfg.HALeaseDuration
+	}
+	if !set["shard"] && cfg.Shard != "" {
+		s.shardFlag = cfg.Shard
+	}
+	if !set["redis.addr"] && len(cfg.Targets) > 0 {
+		s.targetAddrs, s.targetPasswords = cfg.addrs()
+		// an explicit --redis.password applies to the targets of the file
+		if set["redis.password"] {
+			s.targetPasswords = nil
+		}
+	}
+}
+
+// targets returns the addresses and passwords of the redis nodes, the
+// targets of the config file or else --redis.addr and --redis.password
+// split by separator.
+func (s *settings) targets() ([]string, []string) {
+	passwords := strings.Split(s.redisPassword, s.separator)
+	if len(s.targetAddrs) == 0 {
+		return strings.Split(s.redisAddr, s.separator), passwords
+	}
+	if s.targetPasswords != nil {
+		passwords = s.targetPasswords
+	}
+	return append([]string{}, s.targetAddrs...), append([]string{}, passwords...)
+}
+
+// checkAPI returns an error if the API of flag name, which lets clients
+// do what, is enabled without clients being authenticated or restricted.
+// Unix domain sockets are protected by their file permissions.
+func (s *settings) checkAPI(name string, enabled bool, what string) error {
+	if _, unix := socketPath(s.listenAddress); !enabled || unix || s.webClientCA != "" || s.allowedSources != "" {
+		return nil
+	}
+	return fmt.Errorf("%s: requires --web.tls-client-ca-file or --web.allowed-sources, anyone reaching the exporter could %s otherwise", name, what)
+}
+
+// memorySamplesOption converts --check-keys-memory-samples, which follows
+// the SAMPLES argument of MEMORY USAGE, to exporter.Options.KeyMemorySamples.
+func (s *settings) memorySamplesOption() int {
+	if s.memorySamples == 0 {
+		return -1
+	}
+	return s.memorySamples
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAddrs returns addrs with the passwords of their user info redacted
+// for logging.
+func redactAddrs(addrs []string) []string {
+	res := make([]string, len(addrs))
+	for i, addr := range addrs {
+		res[i] = exporter.RedactAddr(addr)
+	}
+	return res
 }
 
 // getEnv gets an environment variable from a given key and if it doesn't exist,
@@ -98,3 +855,21 @@ func getEnv(key string, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// replayFiles returns the files of dir for --replay.dir, sorted by name.
+func replayFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			files = append(files, filepath.Join(dir, fi.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("replay.dir: no files in %s", dir)
+	}
+	return files, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+)
+
+// registeredTarget is a redis node registered at runtime via the targets
+// API, scraped through /scrape and listed by /sd next to the configured ones.
+type registeredTarget struct {
+	Addr     string     `json:"addr"`
+	Password string     `json:"password,omitempty"`
+	Alias    string     `json:"alias,omitempty"`
+	Role     string     `json:"role,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+
+	// source is set for targets registered by the exporter itself, e.g.
+	// "sentinel", instead of via the API
+	source string
+}
+
+// targetRegistry holds the registered targets. Targets registered with a
+// TTL are evicted unless registered again before it runs out, so entries of
+// short-lived instances don't pile up.
+type targetRegistry struct {
+	mtx     sync.Mutex
+	targets map[string]registeredTarget
+}
+
+func newTargetRegistry() *targetRegistry {
+	return &targetRegistry{targets: map[string]registeredTarget{}}
+}
+
+// register adds t or refreshes it if it's already registered, a ttl of 0
+// keeps it until it's unregistered.
+func (r *targetRegistry) register(t registeredTarget, ttl time.Duration) {
+	t.Expires = nil
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		t.Expires = &expires
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.targets[t.Addr] = t
+}
+
+// sync replaces all targets of source by targets.
+func (r *targetRegistry) sync(source string, targets []registeredTarget) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for addr, t := range r.targets {
+		if t.source == source {
+			delete(r.targets, addr)
+		}
+	}
+	for _, t := range targets {
+		if old, ok := r.targets[t.Addr]; ok && old.source == "" {
+			// registered via the API, which takes precedence
+			continue
+		}
+		t.source = source
+		r.targets[t.Addr] = t
+	}
+}
+
+// unregister removes the target addr, it returns false if it wasn't registered.
+func (r *targetRegistry) unregister(addr string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.targets[addr]
+	delete(r.targets, addr)
+	return ok
+}
+
+// evict removes the expired targets. The caller must hold mtx.
+func (r *targetRegistry) evict() {
+	now := time.Now()
+	for addr, t := range r.targets {
+		if t.Expires != nil && now.After(*t.Expires) {
+			delete(r.targets, addr)
+		}
+	}
+}
+
+// get returns the registered target addr.
+func (r *targetRegistry) get(addr string) (registeredTarget, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.evict()
+	t, ok := r.targets[addr]
+	return t, ok
+}
+
+// list returns the registered targets sorted by address.
+func (r *targetRegistry) list() []registeredTarget {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.evict()
+	res := make([]registeredTarget, 0, len(r.targets))
+	for _, t := range r.targets {
+		res = append(res, t)
+	}
+	sort.Sort(byTargetAddr(res))
+	return res
+}
+
+type byTargetAddr []registeredTarget
+
+func (s byTargetAddr) Len() int           { return len(s) }
+func (s byTargetAddr) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTargetAddr) Less(i, j int) bool { return s[i].Addr < s[j].Addr }
+
+// registerRequest is the body of POST /api/targets/register.
+type registerRequest struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	Alias    string `json:"alias"`
+	TTL      string `json:"ttl"`
+}
+
+// registerAPIHandler serves the targets API: POST /api/targets/register adds
+// or refreshes a target, DELETE /api/targets/register?target=<addr> removes
+// one, GET lists the registered targets without their passwords. It's only
+// served with --web.enable-targets-api.
+func (i *instance) registerAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		targets := i.registered.list()
+		for idx := range targets {
+			targets[idx].Addr = exporter.RedactAddr(targets[idx].Addr)
+			targets[idx].Password = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	case http.MethodPost:
+		var req registerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := exporter.ValidateAddr(req.Addr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := i.allowlist.allows(req.Addr); err != nil {
+			i.rejectedTargets.Inc()
+			log.WithField("target", exporter.LabelAddr(req.Addr)).Warn("rejected registered target not in the allowlist")
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl < 0 {
+				http.Error(w, fmt.Sprintf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+				return
+			}
+		}
+		i.registered.register(registeredTarget{Addr: req.Addr, Password: req.Password, Alias: req.Alias}, ttl)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		if _, err := i.allowlist.allows(target); err != nil {
+			i.rejectedTargets.Inc()
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if !i.registered.unregister(target) {
+			http.Error(w, "unknown target", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "only GET, POST and DELETE are allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeHandler serves the metrics of a single redis node given by the
+// target parameter, e.g. /scrape?target=redis://host:6379. The keys to
+// check can be set per request via check-keys, replacing --check-keys.
+// check_keys is accepted as well since relabeling can only set parameters
+// that are valid label names. sections restricts the scrape to some INFO
+// sections and collectors, see exporter.Options.Sections. module selects a
+// scrape profile of the config file, the other parameters override it.
+// Targets other than the configured ones and the ones registered by the
+// exporter itself (e.g. via sentinel) must be in the allowlist of the
+// instance, if any, targets allowed by resolving their name are dialed at
+// the checked address. Like a target that can't be dialed, a target whose
+// name doesn't resolve is answered with probe_success 0, invalid parameters
+// and targets not in the allowlist with 400 and 403. Requests of a target
+// scraped less than --min-scrape-interval ago are answered with 429.
+func (i *instance) scrapeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	target := query.Get("target")
+	if target == "" {
+		http.Error(w, "missing target parameter", http.StatusBadRequest)
+		return
+	}
+	if err := exporter.ValidateAddr(target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	password, known := i.passwords[target]
+	if !known {
+		// targets of /sd have the credentials of their URL removed
+		for _, addr := range i.addrs {
+			if exporter.LabelAddr(addr) == target {
+				target, password, known = addr, i.passwords[addr], true
+			}
+		}
+		for _, t := range i.registered.list() {
+			if t.Addr == target || exporter.LabelAddr(t.Addr) == target {
+				// targets registered via the API are checked like any other
+				target, password, known = t.Addr, t.Password, t.source != ""
+			}
+		}
+	}
+
+	opts := i.opts
+	if !known {
+		ip, err := i.allowlist.allows(target)
+		if _, unresolved := err.(*resolveError); unresolved {
+			log.WithField("target", exporter.LabelAddr(target)).WithError(err).Warn("couldn't resolve /scrape target")
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(newProbeCollector(nil, opts.Namespace))
+			i.gathererHandler(registry).ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			i.rejectedTargets.Inc()
+			log.WithField("target", exporter.LabelAddr(target)).Warn("rejected /scrape target not in the allowlist")
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if ip != nil {
+			host, _ := targetHost(target)
+			opts.DialHosts = map[string]string{host: ip.String()}
+		}
+	}
+	if name := query.Get("module"); name != "" {
+		m, ok := i.modules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+			return
+		}
+		opts = m.apply(opts)
+	}
+	keys, ok := query["check-keys"]
+	if underscored, found := query["check_keys"]; found {
+		keys, ok = append(keys, underscored...), true
+	}
+	if ok {
+		opts.CheckKeys = strings.Join(keys, ",")
+		if err := exporter.ValidateCheckKeys(opts.CheckKeys); err != nil {
+			http.Error(w, fmt.Sprintf("invalid check-keys: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sections, ok := query["sections"]; ok {
+		opts.Sections = nil
+		for _, s := range strings.Split(strings.Join(sections, ","), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				opts.Sections = append(opts.Sections, s)
+			}
+		}
+		if err := exporter.ValidateSections(opts.Sections); err != nil {
+			http.Error(w, fmt.Sprintf("invalid sections: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the checked address is part of the key, so an exporter isn't kept
+	// dialing an address the name doesn't resolve to anymore
+	key := strings.Join([]string{target, password, query.Get("module"), opts.CheckKeys, strings.Join(opts.Sections, ","), fmt.Sprint(opts.DialHosts)}, "\x00")
+	exp, wait, err := i.probes.get(key, opts, func() (*exporter.Exporter, error) {
+		return exporter.NewRedisExporterWithOptions(
+			exporter.RedisHost{Addrs: []string{target}, Passwords: []string{password}}, opts)
+	})
+	if err != nil {
+		log.WithField("target", exporter.LabelAddr(target)).WithError(err).Error("couldn't create exporter")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, fmt.Sprintf("target scraped less than %s ago", opts.MinScrapeInterval), http.StatusTooManyRequests)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newProbeCollector(exp, opts.Namespace))
+	i.gathererHandler(registry).ServeHTTP(w, r)
+}
+
+// probeCollector adds probe_success and probe_duration_seconds to the
+// metrics of the single target of exp, like the blackbox_exporter, so
+// /scrape always answers with 200 and unreachable targets are told apart by
+// the metrics instead. Without exp, e.g. for a target that doesn't resolve,
+// only probe_success 0 is collected.
+type probeCollector struct {
+	exp      *exporter.Exporter
+	success  *prometheus.Desc
+	duration *prometheus.Desc
+}
+
+func newProbeCollector(exp *exporter.Exporter, namespace string) *probeCollector {
+	return &probeCollector{
+		exp:      exp,
+		success:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "probe_success"), "Whether the target could be scraped", nil, nil),
+		duration: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "probe_duration_seconds"), "How long scraping the target took", nil, nil),
+	}
+}
+
+func (p *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	if p.exp != nil {
+		p.exp.Describe(ch)
+	}
+	ch <- p.success
+	ch <- p.duration
+}
+
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	if p.exp == nil {
+		ch <- prometheus.MustNewConstMetric(p.success, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(p.duration, prometheus.GaugeValue, 0)
+		return
+	}
+	start := time.Now()
+	p.exp.Collect(ch)
+	duration := time.Since(start).Seconds()
+
+	success := 0.0
+	if st := p.exp.TargetStatuses(); len(st) == 1 && st[0].Up {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(p.success, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(p.duration, prometheus.GaugeValue, duration)
+}
+
+// probeExporterTTL is how long the exporter of a /scrape target is kept
+// after its last request.
+const probeExporterTTL = 10 * time.Minute
+
+// probeExporters keeps the exporters of /scrape targets across requests if
+// --cache-ttl or --min-scrape-interval is set, so their cached results are
+// served to subsequent requests.
+type probeExporters struct {
+	mtx       sync.Mutex
+	exporters map[string]*probeExporter
+}
+
+type probeExporter struct {
+	exp        *exporter.Exporter
+	lastUsed   time.Time
+	lastScrape time.Time
+}
+
+// get returns the exporter of the target and settings key, created by
+// create unless it's kept from a previous request. With
+// opts.MinScrapeInterval, the returned duration is how long to wait until
+// the target may be scraped again, 0 if it may be scraped now.
+func (p *probeExporters) get(key string, opts exporter.Options, create func() (*exporter.Exporter, error)) (*exporter.Exporter, time.Duration, error) {
+	if opts.CacheTTL <= 0 && opts.MinScrapeInterval <= 0 {
+		exp, err := create()
+		return exp, 0, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	for k, pe := range p.exporters {
+		if now.Sub(pe.lastUsed) > probeExporterTTL {
+			delete(p.exporters, k)
+		}
+	}
+	pe, ok := p.exporters[key]
+	if !ok {
+		exp, err := create()
+		if err != nil {
+			return nil, 0, err
+		}
+		if p.exporters == nil {
+			p.exporters = map[string]*probeExporter{}
+		}
+		pe = &probeExporter{exp: exp}
+		p.exporters[key] = pe
+	}
+	pe.lastUsed = now
+	if wait := pe.lastScrape.Add(opts.MinScrapeInterval).Sub(now); opts.MinScrapeInterval > 0 && wait > 0 {
+		return pe.exp, wait, nil
+	}
+	pe.lastScrape = now
+	return pe.exp, 0, nil
+}
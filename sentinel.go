@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// registerSentinelNodes keeps the registered targets in sync with the masters
+// (and with --sentinel.register-replicas their replicas) monitored by the
+// sentinels among the configured targets of the instance returned by inst,
+// so they're scraped as targets of their own which follow failovers.
+func registerSentinelNodes(inst func() *instance) {
+	for {
+		i := inst()
+		nodes, err := i.exp.SentinelNodes(i.settings.sentinelReplicas)
+		if err != nil {
+			log.Warnf("Couldn't discover the nodes monitored by sentinel, err: %s", err)
+		} else {
+			targets := make([]registeredTarget, 0, len(nodes))
+			for _, n := range nodes {
+				targets = append(targets, registeredTarget{Addr: n.Addr, Password: i.passwords[n.Sentinel], Alias: n.Master, Role: n.Role})
+			}
+			i.registered.sync("sentinel", targets)
+			log.Debugf("Registered %d nodes discovered via sentinel", len(targets))
+		}
+		time.Sleep(i.settings.sentinelInterval)
+	}
+}
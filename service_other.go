@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// runAsService is only supported on Windows.
+func runAsService() bool {
+	return false
+}
@@ -0,0 +1,150 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "redis_exporter"
+
+func init() {
+	commands["install-service"] = command{help: "Install redis_exporter as a Windows service, remaining flags are passed to the service", run: installService}
+	commands["uninstall-service"] = command{help: "Remove the redis_exporter Windows service", run: uninstallService}
+}
+
+// runAsService runs serve() under the Windows service control manager if
+// the process was started by it, it returns false otherwise.
+func runAsService() bool {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil || interactive {
+		return false
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return false
+	}
+	defer elog.Close()
+	log.AddHook(&eventLogHook{elog: elog})
+
+	if err := svc.Run(serviceName, &serviceHandler{}); err != nil {
+		elog.Error(1, fmt.Sprintf("%s service failed: %s", serviceName, err))
+		os.Exit(1)
+	}
+	return true
+}
+
+type serviceHandler struct{}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	go serve()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Printf("Stopping %s service", serviceName)
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func installService() int {
+	exePath, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	if filepath.Ext(exePath) == "" {
+		exePath += ".exe"
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(serviceName, exePath, mgr.Config{
+		DisplayName: "Redis Metrics Exporter",
+		Description: "Prometheus exporter for Redis metrics",
+		StartType:   mgr.StartAutomatic,
+	}, os.Args[2:]...)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		log.Error(err)
+		return 1
+	}
+	fmt.Printf("Installed service %s: %s %v\n", serviceName, exePath, os.Args[2:])
+	return 0
+}
+
+func uninstallService() int {
+	m, err := mgr.Connect()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		log.Error(err)
+		return 1
+	}
+	eventlog.Remove(serviceName)
+	fmt.Printf("Removed service %s\n", serviceName)
+	return 0
+}
+
+// eventLogHook sends all log output to the Windows event log.
+type eventLogHook struct {
+	elog *eventlog.Log
+}
+
+func (h *eventLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *eventLogHook) Fire(entry *log.Entry) error {
+	msg, err := entry.String()
+	if err != nil {
+		return err
+	}
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel, log.ErrorLevel:
+		return h.elog.Error(1, msg)
+	case log.WarnLevel:
+		return h.elog.Warning(1, msg)
+	default:
+		return h.elog.Info(1, msg)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// shard is the part of the targets scraped by one of several exporter
+// replicas sharing the same target list, see --shard.
+type shard struct {
+	index, total int
+}
+
+// parseShard parses a --shard value of the form <index>/<total>, index
+// counting from 1. The empty string is the single shard owning all targets.
+func parseShard(s string) (shard, error) {
+	if s == "" {
+		return shard{index: 1, total: 1}, nil
+	}
+	frags := strings.Split(s, "/")
+	if len(frags) != 2 {
+		return shard{}, fmt.Errorf("invalid shard %q, expected <index>/<total>, e.g. 2/5", s)
+	}
+	index, err1 := strconv.Atoi(frags[0])
+	total, err2 := strconv.Atoi(frags[1])
+	if err1 != nil || err2 != nil || total < 1 || index < 1 || index > total {
+		return shard{}, fmt.Errorf("invalid shard %q, expected <index>/<total> with 1 <= index <= total", s)
+	}
+	return shard{index: index, total: total}, nil
+}
+
+// owns returns whether addr belongs to the shard. Targets are assigned by
+// rendezvous hashing, so changing the number of shards only moves the
+// targets of the shards added or removed.
+func (s shard) owns(addr string) bool {
+	if s.total <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(addr))
+	key := h.Sum64()
+
+	best, bestWeight := 0, uint64(0)
+	for i := 1; i <= s.total; i++ {
+		if w := mix64(key ^ mix64(uint64(i))); i == 1 || w > bestWeight {
+			best, bestWeight = i, w
+		}
+	}
+	return best == s.index
+}
+
+// mix64 is the finalizer of splitmix64, spreading small differences of x
+// over all bits of the result.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// filter returns the addrs owned by the shard and their passwords.
+func (s shard) filter(addrs, passwords []string) ([]string, []string) {
+	if s.total <= 1 {
+		return addrs, passwords
+	}
+	var ownAddrs, ownPasswords []string
+	for idx, addr := range addrs {
+		if s.owns(addr) {
+			ownAddrs = append(ownAddrs, addr)
+			ownPasswords = append(ownPasswords, passwords[idx])
+		}
+	}
+	return ownAddrs, ownPasswords
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/oliver006/redis_exporter/exporter"
+)
+
+// sdNotify sends state to systemd when running as a Type=notify service,
+// it does nothing if $NOTIFY_SOCKET isn't set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the watchdog timeout configured by systemd
+// for this process, or 0 if the watchdog isn't enabled.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdWatchdog pings the systemd watchdog at half its timeout for as long as
+// the scrapes of the exporter returned by exp keep making progress, so
+// systemd restarts a wedged exporter.
+func sdWatchdog(exp func() *exporter.Exporter) {
+	timeout := sdWatchdogInterval()
+	if timeout == 0 {
+		return
+	}
+	log.Debugf("Enabling systemd watchdog, timeout: %s", timeout)
+
+	for range time.Tick(timeout / 2) {
+		if exp().ScrapeStalled(timeout) {
+			log.Warnf("Scrapes stalled for more than %s, skipping watchdog ping", timeout)
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Warnf("Couldn't ping systemd watchdog, err: %s", err)
+		}
+	}
+}
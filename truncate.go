@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// byteCounter is an io.Writer counting the bytes written to it.
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// truncatingGatherer caps the metrics of a scrape at maxSeries series and
+// maxBytes bytes of the text format, 0 meaning no limit, protecting
+// Prometheus from misconfigurations like a check-keys glob matching millions
+// of keys. Metric families are kept in the order gathered, i.e. by name,
+// the overflow is dropped and exporter_scrape_truncated is set to 1.
+type truncatingGatherer struct {
+	g                   prometheus.Gatherer
+	maxSeries, maxBytes int
+	namespace           string
+}
+
+func (t truncatingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := t.g.Gather()
+	if len(mfs) == 0 {
+		return mfs, err
+	}
+
+	var res []*dto.MetricFamily
+	series, size, dropped := 0, 0, 0
+	for _, mf := range mfs {
+		kept := &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+		for _, m := range mf.Metric {
+			mSize := int(textSize(&dto.MetricFamily{Name: mf.Name, Type: mf.Type, Metric: []*dto.Metric{m}}))
+			if dropped > 0 || (t.maxSeries > 0 && series+1 > t.maxSeries) || (t.maxBytes > 0 && size+mSize > t.maxBytes) {
+				dropped++
+				continue
+			}
+			kept.Metric = append(kept.Metric, m)
+			series, size = series+1, size+mSize
+		}
+		if len(kept.Metric) > 0 {
+			res = append(res, kept)
+		}
+	}
+
+	truncated := 0.0
+	if dropped > 0 {
+		truncated = 1
+	}
+	res = append(res,
+		gaugeFamily(prometheus.BuildFQName(t.namespace, "", "exporter_scrape_truncated"), "Whether series of this scrape were dropped because it exceeded --max-series-per-scrape or --max-response-bytes", truncated),
+		gaugeFamily(prometheus.BuildFQName(t.namespace, "", "exporter_scrape_series_dropped"), "Number of series of this scrape dropped because it exceeded --max-series-per-scrape or --max-response-bytes", float64(dropped)),
+	)
+	return res, err
+}
+
+// textSize returns the size of mf in the text format.
+func textSize(mf *dto.MetricFamily) byteCounter {
+	var c byteCounter
+	expfmt.MetricFamilyToText(&c, mf)
+	return c
+}
+
+// gaugeFamily returns the metric family of a single gauge without labels.
+func gaugeFamily(name, help string, value float64) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name:   proto.String(name),
+		Help:   proto.String(help),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(value)}}},
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultVaultKey             = "password"
+	defaultVaultRefreshInterval = 5 * time.Minute
+)
+
+// VaultConfig configures fetching the passwords of the targets with a
+// vault_path from HashiCorp Vault.
+type VaultConfig struct {
+	// Address defaults to $VAULT_ADDR.
+	Address string `yaml:"address"`
+	// Token defaults to $VAULT_TOKEN. TokenFile is read on every request,
+	// e.g. for the sink of a Vault agent renewing the token.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	// Key is the field of the secret holding the password, "username" is
+	// used as ACL user if the secret has that field.
+	Key             string        `yaml:"key"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	Timeout         time.Duration `yaml:"timeout"`
+}
+
+// vaultSecret is a fetched secret and when it's due for renewal.
+type vaultSecret struct {
+	user, password string
+	leaseID        string
+	renewable      bool
+	refresh        time.Time
+	expires        time.Time
+}
+
+// vaultResponse is the part of a Vault API response used by vaultProvider.
+// The data of KV version 2 secrets is nested in data.data.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// vaultProvider is an exporter.CredentialProvider reading the credentials of
+// the targets from the Vault secret at their vault_path. Secrets are read
+// again after the refresh interval, secrets with a renewable lease (e.g. of
+// the database secrets engine) are renewed at half their lease instead.
+type vaultProvider struct {
+	cfg    VaultConfig
+	paths  map[string]string
+	client *http.Client
+
+	// mtx only guards the maps, the secrets are fetched without holding it
+	mtx     sync.Mutex
+	secrets map[string]vaultSecret
+	fetches map[string]*vaultFetch
+}
+
+// vaultFetch is a fetch of a secret in flight, its result is shared by all
+// callers waiting for the same secret.
+type vaultFetch struct {
+	done   chan struct{}
+	secret vaultSecret
+	err    error
+}
+
+// newVaultProvider returns the provider of the vault section of cfg, or nil
+// if no target has a vault_path.
+func newVaultProvider(cfg *Config) *vaultProvider {
+	paths := map[string]string{}
+	for _, t := range cfg.allTargets() {
+		if t.VaultPath != "" {
+			paths[t.Addr] = t.VaultPath
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	vc := cfg.Vault
+	if vc.Address == "" {
+		vc.Address = os.Getenv("VAULT_ADDR")
+	}
+	if vc.Token == "" && vc.TokenFile == "" {
+		vc.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if vc.Key == "" {
+		vc.Key = defaultVaultKey
+	}
+	if vc.RefreshInterval <= 0 {
+		vc.RefreshInterval = defaultVaultRefreshInterval
+	}
+	if vc.Timeout <= 0 {
+		vc.Timeout = 10 * time.Second
+	}
+	return &vaultProvider{
+		cfg:     vc,
+		paths:   paths,
+		client:  &http.Client{Timeout: vc.Timeout},
+		secrets: map[string]vaultSecret{},
+		fetches: map[string]*vaultFetch{},
+	}
+}
+
+// Credentials implements exporter.CredentialProvider. If Vault can't be
+// reached, the last secret is used until its lease expires. A secret is
+// fetched once for all concurrent callers, which keep using the last secret
+// meanwhile if it's still valid.
+func (v *vaultProvider) Credentials(addr string) (string, string, error) {
+	path, ok := v.paths[addr]
+	if !ok {
+		return "", "", nil
+	}
+
+	v.mtx.Lock()
+	now := time.Now()
+	s, ok := v.secrets[path]
+	valid := ok && (s.expires.IsZero() || now.Before(s.expires))
+	if ok && now.Before(s.refresh) {
+		v.mtx.Unlock()
+		return s.user, s.password, nil
+	}
+	f, fetching := v.fetches[path]
+	if fetching && valid {
+		v.mtx.Unlock()
+		return s.user, s.password, nil
+	}
+	if !fetching {
+		f = &vaultFetch{done: make(chan struct{})}
+		v.fetches[path] = f
+	}
+	v.mtx.Unlock()
+
+	if fetching {
+		<-f.done
+	} else {
+		f.secret, f.err = v.fetch(path, s, ok)
+		v.mtx.Lock()
+		if f.err == nil {
+			v.secrets[path] = f.secret
+		}
+		delete(v.fetches, path)
+		v.mtx.Unlock()
+		close(f.done)
+	}
+
+	if f.err != nil {
+		if valid {
+			log.Warnf("Couldn't read vault secret %s, using the last one, err: %s", path, f.err)
+			return s.user, s.password, nil
+		}
+		return "", "", fmt.Errorf("vault secret %s: %s", path, f.err)
+	}
+	return f.secret.user, f.secret.password, nil
+}
+
+// fetch renews the lease of the last secret s of path if there is one
+// (ok) and it's renewable and not expired yet, otherwise or if that fails it
+// reads the secret again.
+func (v *vaultProvider) fetch(path string, s vaultSecret, ok bool) (vaultSecret, error) {
+	if ok && s.renewable && s.leaseID != "" && (s.expires.IsZero() || time.Now().Before(s.expires)) {
+		next, err := v.renew(s)
+		if err == nil {
+			return next, nil
+		}
+		log.Warnf("Couldn't renew the lease of vault secret %s, reading it again, err: %s", path, err)
+	}
+	return v.read(path)
+}
+
+// read fetches the secret at path.
+func (v *vaultProvider) read(path string) (vaultSecret, error) {
+	resp, err := v.request("GET", "/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return vaultSecret{}, err
+	}
+	data := resp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	password, ok := data[v.cfg.Key].(string)
+	if !ok {
+		return vaultSecret{}, fmt.Errorf("no string field %q", v.cfg.Key)
+	}
+	s := vaultSecret{password: password, leaseID: resp.LeaseID, renewable: resp.Renewable}
+	s.user, _ = data["username"].(string)
+	v.schedule(&s, resp.LeaseDuration)
+	return s, nil
+}
+
+// renew extends the lease of s.
+func (v *vaultProvider) renew(s vaultSecret) (vaultSecret, error) {
+	body, err := json.Marshal(map[string]string{"lease_id": s.leaseID})
+	if err != nil {
+		return s, err
+	}
+	resp, err := v.request("PUT", "/v1/sys/leases/renew", body)
+	if err != nil {
+		return s, err
+	}
+	s.renewable = resp.Renewable
+	v.schedule(&s, resp.LeaseDuration)
+	return s, nil
+}
+
+// schedule sets when s is refreshed and expires for a lease of leaseSeconds,
+// 0 meaning the secret has no lease.
+func (v *vaultProvider) schedule(s *vaultSecret, leaseSeconds int) {
+	now := time.Now()
+	s.refresh, s.expires = now.Add(v.cfg.RefreshInterval), time.Time{}
+	if leaseSeconds <= 0 {
+		return
+	}
+	lease := time.Duration(leaseSeconds) * time.Second
+	s.expires = now.Add(lease)
+	if s.leaseID != "" && s.renewable || lease/2 < v.cfg.RefreshInterval {
+		s.refresh = now.Add(lease / 2)
+	}
+}
+
+// request calls the Vault API.
+func (v *vaultProvider) request(method, path string, body []byte) (*vaultResponse, error) {
+	token := v.cfg.Token
+	if v.cfg.TokenFile != "" {
+		b, err := ioutil.ReadFile(v.cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.cfg.Address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("%s %s: invalid response: %s", method, path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.Join(res.Errors, ", "))
+	}
+	return &res, nil
+}